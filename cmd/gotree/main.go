@@ -22,12 +22,14 @@ func main() {
 	var err error
 	var code []byte
 	raw := os.Getenv("GOTREE_RAW") != ""
+	spans := os.Getenv("SDT_SPANS") != ""
 
 	if len(os.Args) != 2 {
 		utils.Fail("`%s` requires exactly one filename argument", os.Args[0])
 	}
 	if os.Args[1] == "-h" || os.Args[1] == "--help" {
 		utils.Info("Golang parse tree: may set GOTREE_RAW for unmassaged AST")
+		utils.Info("May set SDT_SPANS to retain the positions of nodes")
 		return
 	}
 
@@ -37,8 +39,12 @@ func main() {
 		utils.Fail("Unable for read file %s", filename)
 	}
 
+	// Resolved objects print an identifier once, where first seen, and any
+	// later occurrence as a reference to that line.  A tree wants every
+	// identifier where it occurs, so objects are never resolved.
+	mode := parser.AllErrors | parser.SkipObjectResolution
 	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, "", code, parser.AllErrors)
+	f, err := parser.ParseFile(fset, "", code, mode)
 	if err != nil {
 		utils.Fail("Unable for parse Golang file %s (%s)", filename, err)
 	}
@@ -61,7 +67,7 @@ func main() {
 		`^( *)((` +
 			`Struct|Defer|Map|Interface|Switch|Case|For|Return|Package|Func|If|` +
 			`Assign|Arrow|Go|Begin|Select|Opening|Closing|Star|Colon|Ellipsis|` +
-			`.*Pos|[LR]paren|[LR]brace|[LR]brack` +
+			`.*Pos|ValueEnd|FileStart|FileEnd|[LR]paren|[LR]brace|[LR]brack` +
 			`): )(.*)`)
 	reCloseBrace := regexp.MustCompile(`^ *}$`)
 	reEndLineBrace := regexp.MustCompile(`{$`)
@@ -85,6 +91,9 @@ func main() {
 			parts := strings.Split(line, ":")
 			if len(parts) == 3 {
 				lineno, _ = strconv.Atoi(strings.Replace(parts[1], " ", "0", -1))
+				if spans {
+					fmt.Fprintf(os.Stdout, "%05d | %s\n", lineno, line)
+				}
 			}
 			//justNode := lineMark.ReplaceAllString(line, "$1$2")
 			//fmt.Fprintf(os.Stdout, "%05d | %s?\n", lineno, justNode)
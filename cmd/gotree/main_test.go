@@ -38,12 +38,7 @@ var parsed string = `SrcLn | Node
 00002 |       Recv: nil
 00002 |       Name: *ast.Ident
 00004 |         Name: "main"
-00004 |         Obj: *ast.Object
-00004 |           Kind: func
-00004 |           Name: "main"
-00004 |           Decl: *(obj @ 29)
-00004 |           Data: nil
-00004 |           Type: nil
+00004 |         Obj: nil
 00004 |       Type: *ast.FuncType
 00004 |         TypeParams: nil
 00004 |         Params: *ast.FieldList
@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -33,8 +34,51 @@ const usage = `Usage of Semantic Diff Tool (sdt):
   status, -s      List all analyzable files modified since last git commit
   semantic, -l    List semantically meaningful changes (default viz HEAD:)
   parsetree, -p   Full syntax tree differences (where applicable)
+  range-diff      Pair commits of two ranges (OLD..TIP NEW..TIP) and report
+                  whether each commit's semantic effect changed
+  log             Count semantic, cosmetic, and unsupported files changed
+                  by each commit in a range (e.g. v1.0..HEAD)
+  --first-parent  Follow only the first parent of merges when walking
+  --cosmetic-only Only list commits without semantic changes
+  blame-ignore-revs  List formatting-only commits of a range in the
+                  .git-blame-ignore-revs format
+  --update        Append only new entries to .git-blame-ignore-revs
+  --allow-unsupported  Permit files with no analyzer in formatting-only
+                  commits (also for log --cosmetic-only)
+  hooks           "hooks install" adds pre-commit, commit-msg and pre-push
+                  git hooks (chaining any existing ones); "hooks run NAME"
+                  applies the semantic policy for one of them (pre-commit
+                  only reports what is staged, and never rejects a commit)
+  history         List commits changing the behavior of one function,
+                  method, or class (PATH SYMBOL, e.g. Class.method)
+  rules test      Show which rewrite rules of .sdt-rules.toml fired on which
+                  segments of a semantic diff (same -A and -B)
+  tree            Print the normalized tree (or canonical form) sdt compares
+                  for one file, on disk or as REV:PATH
+  --raw           Print the output of the configured parser instead
+  --json          Print the tree model of semantic diffs as JSON instead
   -g, --glob      Limit compared files by a glob pattern
   -m, --minimal   Show only exact changes in semantic diffs
+  --show=all      Show every segment of a semantic diff labelled with its
+                  kind of change, not only semantic ones (default: semantic)
+  --sort=risk     Order the segments of each file's semantic diff riskiest
+                  first, weighing the kinds of nodes changed (default: diff)
+  --symbols       List the functions, classes, and other declarations whose
+                  content changed semantically, rather than diff segments
+  --docs=separate Report changes to comments and docstrings in a section of
+                  their own, not as semantic; --docs=hide omits them
+                  (default: semantic, judging docstrings as code)
+  --explain       Follow each segment of a semantic diff with the subtrees
+                  of the normalized parse trees that differ on its lines
+  --word-diff     Mark the tokens of changed lines that differ semantically,
+                  as [-old-] and {+new+}, rather than only coloring them
+  --context-depth N  Levels of unchanged structure shown around changes in
+                  the folded view of parsetree (default: 1; 0 for none)
+  --alpha         Treat local variables and parameters renamed consistently
+                  within a function as unchanged (Python, Go, JavaScript)
+  --rename OLD=NEW  Rename an identifier, or a member such as pkg.Foo, in
+                  the source before a semantic diff (may be repeated)
+  --renames FILE  Read such renames from a file, one OLD=NEW per line
   -v, --verbose   Show verbose output on STDERR
   -d, --dumbterm  Monochrome/pipe compatible output (also env CI=true)
   -h, --help      Display this help screen
@@ -48,10 +92,70 @@ const usage = `Usage of Semantic Diff Tool (sdt):
 
     sdt semantic -A 0e904fa3:  # Compare all current files to this revision
     sdt parsetree --src test-branch: --dst HEAD:
+    sdt semantic --symbols -A main:  # Which declarations changed
+    sdt semantic -A main: --rename getUser=fetchUser  # Only this rename?
     sdt semantic -src my-file.go -dst /path/to/other.go  # Files not in git
+    sdt range-diff main..old-topic main..new-topic
+    sdt log HEAD~20..HEAD --cosmetic-only
+    sdt blame-ignore-revs v1.0..HEAD --update
+    sdt history pkg/utils/git/git.go ParseGitStatus
+    sdt hooks install
+    sdt rules test -A main:
+    sdt tree HEAD~3:pkg/types/types.go --json
 
 `
 
+// renameFlags collects the renames given by repeated --rename switches
+type renameFlags map[string]string
+
+func (renames renameFlags) String() string {
+	var specs []string
+	for old, new := range renames {
+		specs = append(specs, old+"="+new)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (renames renameFlags) Set(spec string) error {
+	old, new, found := strings.Cut(spec, "=")
+	old, new = strings.TrimSpace(old), strings.TrimSpace(new)
+	if !found || old == "" || new == "" {
+		return fmt.Errorf("A rename is given as OLD=NEW, not %q", spec)
+	}
+	renames[old] = new
+	return nil
+}
+
+// readRenames adds the renames listed in a file, one OLD=NEW per line,
+// ignoring blank lines and those starting with #
+func readRenames(filename string, renames renameFlags) error {
+	body, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := renames.Set(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subcommands which take positional arguments, and the fewest and most
+var positional = map[string][2]int{
+	"range-diff":        {2, 2},
+	"log":               {1, 1},
+	"blame-ignore-revs": {1, 1},
+	"history":           {2, 2},
+	"hooks":             {1, 4},
+	"rules":             {1, 1},
+	"tree":              {1, 1},
+}
+
 func consistentOptions(options types.Options) string {
 	// For now we will only allow the following combinations
 	//
@@ -84,7 +188,9 @@ func consistentOptions(options types.Options) string {
 	}
 
 	// If no subcommand is given, --src and --dst make no sense
-	if !options.Status && !options.Semantic && !options.Parsetree {
+	if !options.Status && !options.Semantic && !options.Parsetree &&
+		!options.RangeDiff && !options.Log && !options.BlameIgnore &&
+		!options.History && !options.Hooks && !options.Tree {
 		if options.Source != "HEAD:" && options.Destination != "" {
 			return "Specifying source or destination is meaningless without a subcommand"
 		}
@@ -98,6 +204,49 @@ func consistentOptions(options types.Options) string {
 		return "The --glob option may not be used when comparing two local files"
 	}
 
+	// Subcommands taking positional arguments need the right number of them
+	if wanted, found := positional[options.Subcommand]; found {
+		if len(options.Args) < wanted[0] || len(options.Args) > wanted[1] {
+			if wanted[0] == wanted[1] {
+				return fmt.Sprintf("The %s subcommand requires %d arguments",
+					options.Subcommand, wanted[0])
+			}
+			return fmt.Sprintf("The %s subcommand requires %d to %d arguments",
+				options.Subcommand, wanted[0], wanted[1])
+		}
+	}
+	if options.Hooks {
+		action := options.Args[0]
+		if action != "install" && action != "run" {
+			return "The hooks subcommand is either `hooks install` or `hooks run NAME`"
+		}
+		if action == "run" && len(options.Args) < 2 {
+			return "The hook to run must be named, e.g. `hooks run pre-commit`"
+		}
+	}
+	if options.RulesTest && options.Args[0] != "test" {
+		return "The rules subcommand is `rules test`"
+	}
+	if options.Raw && options.JSON {
+		return "The --raw and --json options may not be used together"
+	}
+	if options.Show != types.ShowSemantic && options.Show != types.ShowAll {
+		return "The --show option is either `semantic` or `all`"
+	}
+	if options.Docs != types.DocsSemantic && !options.DocsApart() {
+		return "The --docs option is `semantic`, `separate`, or `hide`"
+	}
+	if options.Sort != types.SortDiff && options.Sort != types.SortRisk {
+		return "The --sort option is either `diff` or `risk`"
+	}
+	if options.RangeDiff {
+		for _, arg := range options.Args {
+			if !strings.Contains(arg, "..") {
+				return "The range-diff arguments must be ranges like base..tip"
+			}
+		}
+	}
+
 	return "HAPPY"
 }
 
@@ -105,6 +254,7 @@ func getOptions() types.Options {
 	// Manually pull out "subcommand" since we do not actually want
 	// different flags for different subcommands
 	subcommand := "FLAGS_ONLY"
+	var args []string
 	if len(os.Args) == 2 && os.Args[1][0] != '-' {
 		// Subcommand only
 		subcommand = os.Args[1]
@@ -112,11 +262,18 @@ func getOptions() types.Options {
 	} else if len(os.Args) > 2 && os.Args[1][0] != '-' {
 		// Subcommand and extra flags
 		subcommand = os.Args[1]
-		// Bad attempt at second subcommand
-		if os.Args[2][0] != '-' {
+		rest := os.Args[2:]
+		if _, found := positional[subcommand]; found {
+			// Positional arguments come before any flags
+			for len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+				args = append(args, rest[0])
+				rest = rest[1:]
+			}
+		} else if rest[0][0] != '-' {
+			// Bad attempt at second subcommand
 			utils.Fail("Only one subcommand may be specified: \n\t%v", os.Args)
 		}
-		os.Args = append(os.Args[:1], os.Args[2:]...)
+		os.Args = append(os.Args[:1], rest...)
 	}
 
 	// Parse flags and switches provided on command line
@@ -129,6 +286,33 @@ func getOptions() types.Options {
 	var parsetree bool
 	flag.BoolVar(&parsetree, "p", false, "Full syntax tree differences")
 
+	var rangeDiff bool
+	var log bool
+	var blameIgnore bool
+	var history bool
+	var hooks bool
+	var rulesTest bool
+	var tree bool
+
+	var raw bool
+	flag.BoolVar(&raw, "raw", false, "Print the parser's own output")
+
+	var asJSON bool
+	flag.BoolVar(&asJSON, "json", false, "Print the tree model as JSON")
+
+	var firstParent bool
+	flag.BoolVar(&firstParent, "first-parent", false, "Follow only first parents")
+
+	var cosmetic bool
+	flag.BoolVar(&cosmetic, "cosmetic-only", false, "Only non-semantic commits")
+
+	var update bool
+	flag.BoolVar(&update, "update", false, "Append only new entries")
+
+	var allowUnsupported bool
+	flag.BoolVar(&allowUnsupported, "allow-unsupported", false,
+		"Permit files with no analyzer")
+
 	var glob string
 	flag.StringVar(&glob, "glob", "", "Limit compared files by a glob pattern")
 	flag.StringVar(&glob, "g", "", "Limit compared files by glob (short flag)")
@@ -137,6 +321,40 @@ func getOptions() types.Options {
 	flag.BoolVar(&minimal, "minimal", false, "Show only exact changes")
 	flag.BoolVar(&minimal, "m", false, "Show only exact changes")
 
+	var show string
+	flag.StringVar(&show, "show", types.ShowSemantic,
+		"Segments of semantic diffs to show (semantic or all)")
+
+	var sortBy string
+	flag.StringVar(&sortBy, "sort", types.SortDiff,
+		"Order of segments of semantic diffs (diff or risk)")
+
+	var symbols bool
+	flag.BoolVar(&symbols, "symbols", false, "Summarize changes by declaration")
+
+	var docs string
+	flag.StringVar(&docs, "docs", types.DocsSemantic,
+		"Changes to comments and docstrings (semantic, separate, or hide)")
+
+	var contextDepth int
+	flag.IntVar(&contextDepth, "context-depth", 1,
+		"Levels of unchanged structure shown around parse tree changes")
+
+	var wordDiff bool
+	flag.BoolVar(&wordDiff, "word-diff", false, "Mark semantically changed tokens")
+
+	var explain bool
+	flag.BoolVar(&explain, "explain", false, "Show the subtrees differing in each segment")
+
+	var alpha bool
+	flag.BoolVar(&alpha, "alpha", false, "Disregard consistent renames of locals")
+
+	renames := renameFlags{}
+	flag.Var(renames, "rename", "Rename an identifier in the source (OLD=NEW)")
+
+	var renameFile string
+	flag.StringVar(&renameFile, "renames", "", "File of renames, one OLD=NEW per line")
+
 	var verbose bool
 	flag.BoolVar(&verbose, "verbose", false, "Show verbose output on STDERR")
 	flag.BoolVar(&verbose, "v", false, "Show verbose output on STDERR")
@@ -163,6 +381,28 @@ func getOptions() types.Options {
 		semantic = true
 	case "parsetree":
 		parsetree = true
+	case "range-diff":
+		rangeDiff = true
+	case "log":
+		log = true
+	case "blame-ignore-revs":
+		blameIgnore = true
+	case "history":
+		history = true
+	case "hooks":
+		hooks = true
+	case "tree":
+		tree = true
+	case "rules":
+		// Rules are tested by the semantic diffs they apply to
+		rulesTest = true
+		semantic = true
+	}
+
+	if renameFile != "" {
+		if err := readRenames(renameFile, renames); err != nil {
+			utils.Fail("Unable to read renames from %s (%s)", renameFile, err)
+		}
 	}
 
 	if os.Getenv("CI") == "true" {
@@ -175,15 +415,39 @@ func getOptions() types.Options {
 
 	// Create a struct with the command-line configured options
 	return types.Options{
-		Status:      status,
-		Semantic:    semantic,
-		Parsetree:   parsetree,
-		Glob:        glob,
-		Minimal:     minimal,
-		Verbose:     verbose,
-		Dumbterm:    dumbterm,
-		Source:      src,
-		Destination: dst,
+		Status:           status,
+		Semantic:         semantic,
+		Parsetree:        parsetree,
+		RangeDiff:        rangeDiff,
+		Log:              log,
+		BlameIgnore:      blameIgnore,
+		History:          history,
+		Hooks:            hooks,
+		Tree:             tree,
+		Raw:              raw,
+		JSON:             asJSON,
+		Subcommand:       subcommand,
+		Glob:             glob,
+		Minimal:          minimal,
+		Show:             show,
+		Sort:             sortBy,
+		Symbols:          symbols,
+		Docs:             docs,
+		Explain:          explain,
+		WordDiff:         wordDiff,
+		ContextDepth:     contextDepth,
+		Alpha:            alpha,
+		Renames:          renames,
+		RulesTest:        rulesTest,
+		FirstParent:      firstParent,
+		Cosmetic:         cosmetic,
+		Update:           update,
+		AllowUnsupported: allowUnsupported,
+		Verbose:          verbose,
+		Dumbterm:         dumbterm,
+		Source:           src,
+		Destination:      dst,
+		Args:             append(args, flag.Args()...),
 	}
 }
 
@@ -224,17 +488,45 @@ func getConfig(options types.Options) (types.Config, string) {
 			commands["sql"] = usersql
 		}
 		if userjs, found := config.Commands["javascript"]; found {
+			if userjs.Offsets == "" {
+				userjs.Offsets = commands["javascript"].Offsets
+			}
 			commands["javascript"] = userjs
 		}
 		if userjson, found := config.Commands["json"]; found {
 			commands["json"] = userjson
 		}
+		if _, err := regexp.Compile(config.Hooks.StylePattern); err != nil {
+			utils.Fail("Invalid style_pattern in %s (%s)", configFile, err)
+		}
+	}
+
+	// Rewrite rules are kept apart, in .sdt-rules.toml beside .sdt.toml
+	rules := config.Rules
+	for _, rulesFile := range []string{
+		"./.sdt-rules.toml", os.Getenv("HOME") + "/.sdt-rules.toml"} {
+		if _, err := os.Stat(rulesFile); err != nil {
+			continue
+		}
+		var file struct {
+			Rules []types.Rule `toml:"rule"`
+		}
+		if _, err := toml.DecodeFile(rulesFile, &file); err != nil {
+			utils.Fail("Unable to read rewrite rules in %s (%s)", rulesFile, err)
+		}
+		rules = append(rules, file.Rules...)
+		break
 	}
 
 	return types.Config{
 		Description: description,
 		Glob:        config.Glob,
 		Commands:    commands,
+		Hooks:       config.Hooks,
+		Risk:        config.Risk,
+		Ordered:     config.Ordered,
+		Unordered:   config.Unordered,
+		Rules:       rules,
 	}, cfgMessage
 }
 
@@ -307,6 +599,52 @@ func main() {
 		}
 	}
 
+	if options.RangeDiff {
+		err := git.RangeDiff(options.Args[0], options.Args[1], options, config)
+		if err != nil {
+			utils.Fail("%s", err)
+		}
+	}
+
+	if options.Log {
+		if err := git.Log(options.Args[0], options, config); err != nil {
+			utils.Fail("%s", err)
+		}
+	}
+
+	if options.BlameIgnore {
+		err := git.BlameIgnoreRevs(options.Args[0], options, config)
+		if err != nil {
+			utils.Fail("%s", err)
+		}
+	}
+
+	if options.History {
+		err := git.SymbolHistory(options.Args[0], options.Args[1], options, config)
+		if err != nil {
+			utils.Fail("%s", err)
+		}
+	}
+
+	if options.Hooks {
+		var err error
+		if options.Args[0] == "install" {
+			err = git.InstallHooks()
+		} else {
+			err = git.RunHook(options.Args[1], options.Args[2:], os.Stdin,
+				options, config)
+		}
+		if err != nil {
+			utils.Fail("%s", err)
+		}
+	}
+
+	if options.Tree {
+		if err := git.PrintTree(options.Args[0], options, config); err != nil {
+			utils.Fail("%s", err)
+		}
+	}
+
 	if options.Verbose {
 		fmt.Fprintf(os.Stderr, "---\n")
 		fmt.Fprintf(os.Stderr, "Description: %s\n", config.Description)
@@ -314,8 +652,17 @@ func main() {
 		fmt.Fprintf(os.Stderr, "status: %t\n", options.Status)
 		fmt.Fprintf(os.Stderr, "semantic: %t\n", options.Semantic)
 		fmt.Fprintf(os.Stderr, "parsetree: %t\n", options.Parsetree)
+		fmt.Fprintf(os.Stderr, "range-diff: %t\n", options.RangeDiff)
+		fmt.Fprintf(os.Stderr, "log: %t\n", options.Log)
+		fmt.Fprintf(os.Stderr, "blame-ignore-revs: %t\n", options.BlameIgnore)
+		fmt.Fprintf(os.Stderr, "history: %t\n", options.History)
+		fmt.Fprintf(os.Stderr, "hooks: %t\n", options.Hooks)
+		fmt.Fprintf(os.Stderr, "tree: %t\n", options.Tree)
 		fmt.Fprintf(os.Stderr, "glob: %s\n", options.Glob)
 		fmt.Fprintf(os.Stderr, "minimal: %t\n", options.Minimal)
+		fmt.Fprintf(os.Stderr, "show: %s\n", options.Show)
+		fmt.Fprintf(os.Stderr, "sort: %s\n", options.Sort)
+		fmt.Fprintf(os.Stderr, "symbols: %t\n", options.Symbols)
 		fmt.Fprintf(os.Stderr, "source: %s\n", options.Source)
 		fmt.Fprintf(os.Stderr, "destination: %s\n", options.Destination)
 		fmt.Fprintf(os.Stderr, "dumbterm: %t\n", options.Dumbterm)
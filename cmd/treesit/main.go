@@ -19,6 +19,7 @@ func main() {
 	var body []byte
 	var err error
 	comments := os.Getenv("TREESIT_COMMENTS") != ""
+	spans := os.Getenv("SDT_SPANS") != ""
 
 	if len(os.Args) != 2 {
 		utils.Fail("`%s` requires exactly one filename argument", os.Args[0])
@@ -26,6 +27,7 @@ func main() {
 	if os.Args[1] == "-h" || os.Args[1] == "--help" {
 		utils.Info("Tree-sitter based parse tree: may set TREESITE_COMMENTS to retain comments")
 		utils.Info("TREESIT_COMMENTS %t", comments)
+		utils.Info("May set SDT_SPANS to append the span of each node")
 		return
 	}
 
@@ -80,6 +82,10 @@ func main() {
 			}
 		}
 		line = strings.Replace(line, posSpan, sub, 1)
+		if spans {
+			// 1-based lines as in the prefix, but 0-based byte columns
+			line += fmt.Sprintf("\t@%d:%d-%d:%d", lineno+1, left, endline+1, right)
+		}
 		fmt.Fprintf(os.Stdout, "%05d | %s\n", lineno+1, line)
 	}
 }
@@ -2,6 +2,7 @@ package golang
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 
@@ -10,11 +11,92 @@ import (
 )
 
 func simplifyParseTree(parseTree string) string {
+	// Positions of nodes are present when `gotree` is run with SDT_SPANS
+	rePosition := regexp.MustCompile(`(?m)^.{5} \| *\w+: \d+:\d+ *$[\r\n]*`)
+	parseTree = rePosition.ReplaceAllString(parseTree, "")
 	reNoLineCol := regexp.MustCompile(`(?m)^.{5} \| `)
 	return reNoLineCol.ReplaceAllString(parseTree, "")
 }
 
-func Diff(filename string, options types.Options, config types.Config) string {
+// declName finds the identifier a FuncDecl or TypeSpec subtree declares
+func declName(subtree []string) string {
+	for i := 1; i+1 < len(subtree); i++ {
+		if strings.TrimRight(subtree[i], " ") == "  Name: *ast.Ident" {
+			name := strings.TrimSpace(subtree[i+1])
+			return strings.Trim(strings.TrimPrefix(name, "Name: "), `"`)
+		}
+	}
+	return ""
+}
+
+// hasReceiver checks whether a FuncDecl subtree is a method of a type
+func hasReceiver(subtree []string, receiver string) bool {
+	for i := 1; i < len(subtree); i++ {
+		if strings.TrimRight(subtree[i], " ") == "  Recv: *ast.FieldList" {
+			for _, line := range utils.IndentedSubtree(subtree, i, " ") {
+				if strings.TrimSpace(line) == `Name: "`+receiver+`"` {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Subtree extracts the declaration of a function or type from a simplified
+// parse tree.  A method is named as `Type.Method`.  References to objects
+// by position in the full tree are masked, since they shift with any
+// change elsewhere in the file.
+func Subtree(tree string, symbol string) (string, bool) {
+	reDecl := regexp.MustCompile(`^ *(\d+: )?\*ast\.(FuncDecl|TypeSpec) *$`)
+	reObj := regexp.MustCompile(`\(obj @ \d+\)`)
+	receiver, name := "", symbol
+	if dot := strings.LastIndex(symbol, "."); dot >= 0 {
+		receiver, name = symbol[:dot], symbol[dot+1:]
+	}
+
+	lines := strings.Split(tree, "\n")
+	for i, line := range lines {
+		if !reDecl.MatchString(line) {
+			continue
+		}
+		subtree := utils.IndentedSubtree(lines, i, " ")
+		if declName(subtree) != name {
+			continue
+		}
+		if receiver != "" && !hasReceiver(subtree, receiver) {
+			continue
+		}
+		// The index among sibling declarations is not part of the symbol
+		subtree[0] = reDecl.ReplaceAllString(subtree[0], "*ast.$2")
+		return reObj.ReplaceAllString(strings.Join(subtree, "\n"), "(obj @ ?)"), true
+	}
+	return "", false
+}
+
+// RawTree returns the parse tree of one file as the parser reports it,
+// with the positions the tree model needs
+func RawTree(filename string, config types.Config) ([]byte, error) {
+	return utils.FileTree(
+		config.Commands["go"].Executable,
+		config.Commands["go"].Switches,
+		filename)
+}
+
+// Tree returns the simplified parse tree that is compared for one file
+func Tree(filename string, config types.Config) (string, error) {
+	tree, err := RawTree(filename, config)
+	if err != nil {
+		return "", err
+	}
+	return simplifyParseTree(string(tree)), nil
+}
+
+func Diff(
+	filename string,
+	options types.Options,
+	config types.Config,
+) (string, types.ChangeKind) {
 	var headTree []byte
 	var currentTree []byte
 
@@ -41,16 +123,20 @@ func Diff(filename string, options types.Options, config types.Config) string {
 	diffs := dmp.DiffMain(headTreeString, currentTreeString, false)
 
 	if options.Parsetree {
+		if view, change := utils.TreeChanges(
+			filename, headTree, currentTree,
+			types.Go, options, config); change != types.Unsupported {
+			return view, change
+		}
 		return utils.ColorDiff(dmp, diffs,
 			types.Go, options.Dumbterm, options.Minimal)
 	}
 
 	if options.Semantic {
 		return utils.SemanticChanges(
-			dmp, diffs, filename,
-			headTree, headTreeString,
-			types.Go, options.Dumbterm, options.Minimal)
+			filename, headTree, currentTree,
+			types.Go, options, config)
 	}
 
-	return "| No diff type specified"
+	return "| No diff type specified", types.Unsupported
 }
@@ -1,6 +1,8 @@
 package golang_test
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -52,9 +54,10 @@ func TestNoSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file1.name
 
-	report := golang.Diff("", opts, config)
+	report, change := golang.Diff("", opts, config)
 
-	if !strings.Contains(report, "| No semantic differences detected") {
+	if change != types.Cosmetic ||
+		!strings.Contains(report, "| No semantic differences detected") {
 		t.Fatalf("Failed to recognize semantic equivalence of %s and %s",
 			opts.Source, opts.Destination)
 	}
@@ -68,7 +71,7 @@ func TestNoParseTreeDiff(t *testing.T) {
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := golang.Diff("", opts, config)
+	report, _ := golang.Diff("", opts, config)
 
 	// Since we are using the opts.Dumbterm, changes would contain
 	// at least one of addition `{{+` or removal `{{-`
@@ -88,8 +91,11 @@ func TestSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file2.name
 
-	report := golang.Diff("", opts, config)
+	report, change := golang.Diff("", opts, config)
 
+	if change != types.Semantic {
+		t.Fatalf("Judged the change from %s to %s cosmetic", opts.Source, opts.Destination)
+	}
 	if !strings.Contains(report, "-package hello") {
 		t.Fatalf("Failed to recognize semantic difference between %s and %s",
 			opts.Source, opts.Destination)
@@ -110,19 +116,21 @@ func TestSemanticDiff(t *testing.T) {
 
 func TestParseTreeDiff(t *testing.T) {
 	// Narrow the options to these test files
-	// NOTE: The parse tree is a bit messy, and the character-by-character
-	// diffs are hard to read.  Perhaps this will be improved, but just check
-	// for change as it currently exists (identically in Println and package)
+	// NOTE: Unchanged subtrees are folded, so check for the two changes,
+	// to the package name and to the string printed
 	opts := options
 	opts.Source = file0.name
 	opts.Destination = file2.name
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := golang.Diff("", opts, config)
+	report, _ := golang.Diff("", opts, config)
 
-	// Since we are using the opts.Dumbterm, changes have ASCII markers
-	if !strings.Contains(report, "{{-hell}}{{+g}}o{{+odbye}}") {
+	if !strings.Contains(report, `Name("hello" -> "goodbye")`) {
+		t.Fatalf("Failed to parse tree difference between %s and %s",
+			opts.Source, opts.Destination)
+	}
+	if !strings.Contains(report, "goodbye world") {
 		t.Fatalf("Failed to parse tree difference between %s and %s",
 			opts.Source, opts.Destination)
 	}
@@ -131,3 +139,56 @@ func TestParseTreeDiff(t *testing.T) {
 // TODO: Create sample files that contain non-semantic changes mixed with
 // semantic changes we actually wish to identify with SDT
 // func TestNoSpuriousSemantic(t *testing.T) { ... }
+
+func TestSubtree(t *testing.T) {
+	var trees []string
+	for _, file := range []File{file0, file1, file2} {
+		tree, err := golang.Tree(file.name, config)
+		if err != nil {
+			t.Fatalf("Unable to create parse tree of %s", file.name)
+		}
+		trees = append(trees, tree)
+	}
+
+	main0, found := golang.Subtree(trees[0], "main")
+	if !found || !strings.HasPrefix(main0, "*ast.FuncDecl") {
+		t.Fatalf("Failed to extract function `main` from %s", file0.name)
+	}
+	if main1, _ := golang.Subtree(trees[1], "main"); main0 != main1 {
+		t.Fatalf("Function `main` differs between %s and %s", file0.name, file1.name)
+	}
+	if main2, _ := golang.Subtree(trees[2], "main"); main0 == main2 {
+		t.Fatalf("Function `main` same in %s and %s", file0.name, file2.name)
+	}
+}
+
+func TestDocsSeparate(t *testing.T) {
+	// Respacing a line is not a documentation change, even one that begins
+	// the way a comment continuation does, while rewording a comment is
+	dir := t.TempDir()
+	bodies := []string{
+		"package p\n\nfunc f(p *int) {\n\t*p=3\n\tp = nil\n\t// set it\n}\n",
+		"package p\n\nfunc f(p *int) {\n\t*p = 3\n\tp = nil\n\t// set it to three\n}\n",
+	}
+	var names []string
+	for i, body := range bodies {
+		name := filepath.Join(dir, "p"+string(rune('0'+i))+".go")
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatalf("Unable to write %s", name)
+		}
+		names = append(names, name)
+	}
+	opts := options
+	opts.Source = names[0]
+	opts.Destination = names[1]
+	opts.Docs = types.DocsSeparate
+
+	report, _ := golang.Diff("", opts, config)
+	_, docs, found := strings.Cut(report, "Documentation changes")
+	if !found || !strings.Contains(docs, "set it to three") {
+		t.Fatalf("Failed to report the reworded comment:\n%s", report)
+	}
+	if strings.Contains(docs, "*p") {
+		t.Fatalf("Reported respacing as a documentation change:\n%s", docs)
+	}
+}
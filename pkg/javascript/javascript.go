@@ -1,7 +1,9 @@
 package javascript
 
 import (
+	"encoding/json"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
@@ -18,19 +20,115 @@ func simplifyParseTree(parseTree string) string {
 	return mod2
 }
 
-func Diff(filename string, options types.Options, config types.Config) string {
+// declares reports the name a node of the ESTree declares, if any
+func declares(node map[string]interface{}) string {
+	var ident interface{}
+	switch node["type"] {
+	case "FunctionDeclaration", "ClassDeclaration", "VariableDeclarator":
+		ident = node["id"]
+	case "MethodDefinition", "PropertyDefinition", "Property":
+		ident = node["key"]
+	}
+	if id, ok := ident.(map[string]interface{}); ok {
+		if name, ok := id["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// findDeclaration searches depth-first for a node declaring name, and
+// strips the position fields from the subtree found
+func findDeclaration(tree interface{}, name string) interface{} {
+	switch node := tree.(type) {
+	case map[string]interface{}:
+		if declares(node) == name {
+			return node
+		}
+		// Visit keys in a stable order so that the first match is repeatable
+		var keys []string
+		for key := range node {
+			if key != "id" && key != "key" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if found := findDeclaration(node[key], name); found != nil {
+				return found
+			}
+		}
+	case []interface{}:
+		for _, child := range node {
+			if found := findDeclaration(child, name); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// Subtree extracts the declaration of a function, class, variable, or
+// method from a simplified parse tree.  A dotted symbol such as
+// `Class.method` descends through the enclosing declarations in turn.
+func Subtree(tree string, symbol string) (string, bool) {
+	// Masked positions are not JSON, but nor are they wanted in the result
+	reMasked := regexp.MustCompile(`(?m)^\s*"(start|end)": \?,?$[\r\n]*`)
+	var root interface{}
+	if err := json.Unmarshal([]byte(reMasked.ReplaceAllString(tree, "")), &root); err != nil {
+		return "", false
+	}
+	for _, name := range strings.Split(symbol, ".") {
+		root = findDeclaration(root, name)
+		if root == nil {
+			return "", false
+		}
+	}
+	subtree, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return "", false
+	}
+	return string(subtree), true
+}
+
+// jsSwitches fills the configured tool options into the switch template
+func jsSwitches(config types.Config) []string {
+	toolOpts := config.Commands["javascript"].Options
+	var switches []string
+	for _, line := range config.Commands["javascript"].Switches {
+		switches = append(switches, strings.Replace(line, "${OPTIONS}", toolOpts, -1))
+	}
+	return switches
+}
+
+// RawTree returns the parse tree of one file as the parser reports it,
+// with the positions the tree model needs
+func RawTree(filename string, config types.Config) ([]byte, error) {
+	return utils.FileTree(
+		config.Commands["javascript"].Executable, jsSwitches(config), filename)
+}
+
+// Tree returns the simplified parse tree that is compared for one file
+func Tree(filename string, config types.Config) (string, error) {
+	tree, err := RawTree(filename, config)
+	if err != nil {
+		return "", err
+	}
+	return simplifyParseTree(string(tree)), nil
+}
+
+func Diff(
+	filename string,
+	options types.Options,
+	config types.Config,
+) (string, types.ChangeKind) {
 	var currentTree []byte
 	var headTree []byte
 
 	jsCmd := config.Commands["javascript"].Executable
-	switches := config.Commands["javascript"].Switches
-	toolOpts := config.Commands["javascript"].Options
-	canonical := false // Generate AST, don't canonicalize
-
 	// JavaScript processing is templatized with tool options
-	for i, line := range switches {
-		switches[i] = strings.Replace(line, "${OPTIONS}", toolOpts, -1)
-	}
+	switches := jsSwitches(config)
+	canonical := false // Generate AST, don't canonicalize
 
 	if filename == "" {
 		//-- Comparison of two local files
@@ -51,16 +149,20 @@ func Diff(filename string, options types.Options, config types.Config) string {
 	diffs := dmp.DiffMain(headTreeString, currentTreeString, false)
 
 	if options.Parsetree {
+		if view, change := utils.TreeChanges(
+			filename, headTree, currentTree,
+			types.JavaScript, options, config); change != types.Unsupported {
+			return view, change
+		}
 		return utils.ColorDiff(dmp, diffs,
 			types.JavaScript, options.Dumbterm, options.Minimal)
 	}
 
 	if options.Semantic {
 		return utils.SemanticChanges(
-			dmp, diffs, filename,
-			headTree, headTreeString,
-			types.JavaScript, options.Dumbterm, options.Minimal)
+			filename, headTree, currentTree,
+			types.JavaScript, options, config)
 	}
 
-	return "| No diff type specified"
+	return "| No diff type specified", types.Unsupported
 }
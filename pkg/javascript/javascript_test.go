@@ -52,7 +52,7 @@ func TestNoSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file1.name
 
-	report := javascript.Diff("", opts, config)
+	report, _ := javascript.Diff("", opts, config)
 
 	if !strings.Contains(report, "| No semantic differences detected") {
 		t.Fatalf("Failed to recognize semantic equivalence of %s and %s",
@@ -68,7 +68,7 @@ func TestNoParseTreeDiff(t *testing.T) {
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := javascript.Diff("", opts, config)
+	report, _ := javascript.Diff("", opts, config)
 
 	// Since we are using the opts.Dumbterm, changes would contain
 	// at least one of addition `{{+` or removal `{{-`
@@ -88,7 +88,7 @@ func TestSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file2.name
 
-	report := javascript.Diff("", opts, config)
+	report, _ := javascript.Diff("", opts, config)
 
 	if !strings.Contains(report, "-    const sum = a + b;") {
 		t.Fatalf("Failed to recognize semantic difference in `add()` of %s and %s",
@@ -122,23 +122,21 @@ func TestSemanticDiff(t *testing.T) {
 
 func TestParseTreeDiff(t *testing.T) {
 	// Narrow the options to these test files
-	// NOTE: The JS parse tree is a bit messy, and the character-by-character
-	// diffs are hard to read.  Perhaps this will be improved, but just check
-	// for two easy and obvious changes that should not change on cleanup
+	// NOTE: Unchanged subtrees are folded, so check for the exchange of
+	// operands in `mul()`
 	opts := options
 	opts.Source = file0.name
 	opts.Destination = file2.name
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := javascript.Diff("", opts, config)
+	report, _ := javascript.Diff("", opts, config)
 
-	// Since we are using the opts.Dumbterm, changes have ASCII markers
-	if !strings.Contains(report, "{{-b}}{{+a}}") {
+	if !strings.Contains(report, "b -> a") {
 		t.Fatalf("Failed to parse tree difference in `mul()` of %s and %s",
 			opts.Source, opts.Destination)
 	}
-	if !strings.Contains(report, "{{-a}}{{+b}}") {
+	if !strings.Contains(report, "a -> b") {
 		t.Fatalf("Failed to parse tree difference in `mul()` of %s and %s",
 			opts.Source, opts.Destination)
 	}
@@ -150,7 +148,7 @@ func TestNoSpuriousSemantic(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file2.name
 
-	report := javascript.Diff("", opts, config)
+	report, _ := javascript.Diff("", opts, config)
 
 	if strings.Contains(report, "ratio = a / b") {
 		t.Fatalf("Misrecognized semantic difference in `div()` of %s and %s",
@@ -161,3 +159,54 @@ func TestNoSpuriousSemantic(t *testing.T) {
 			opts.Source, opts.Destination)
 	}
 }
+
+var jsTree = `{
+  "type": "Program",
+  "start": ?,
+  "end": ?,
+  "body": [
+    {
+      "type": "ClassDeclaration",
+      "start": ?,
+      "end": ?,
+      "id": {
+        "type": "Identifier",
+        "start": ?,
+        "end": ?,
+        "name": "Foo"
+      },
+      "body": {
+        "type": "ClassBody",
+        "start": ?,
+        "end": ?,
+        "body": [
+          {
+            "type": "MethodDefinition",
+            "start": ?,
+            "end": ?,
+            "kind": "method",
+            "key": {
+              "type": "Identifier",
+              "start": ?,
+              "end": ?,
+              "name": "bar"
+            }
+          }
+        ]
+      }
+    }
+  ]
+}`
+
+func TestSubtree(t *testing.T) {
+	subtree, found := javascript.Subtree(jsTree, "Foo.bar")
+	if !found || !strings.Contains(subtree, `"type": "MethodDefinition"`) {
+		t.Fatalf("Failed to extract method `Foo.bar`, got:\n%s", subtree)
+	}
+	if strings.Contains(subtree, `"start"`) {
+		t.Fatalf("Positions not removed from extracted subtree:\n%s", subtree)
+	}
+	if _, found := javascript.Subtree(jsTree, "bar.Foo"); found {
+		t.Fatalf("Found method `bar.Foo` that does not exist")
+	}
+}
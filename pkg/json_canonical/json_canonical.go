@@ -7,7 +7,23 @@ import (
 	"github.com/atlantistechnology/sdt/pkg/utils"
 )
 
-func Diff(filename string, options types.Options, config types.Config) string {
+// Tree returns the canonical JSON that is compared for one file
+func Tree(filename string, config types.Config) (string, error) {
+	canonical, err := utils.FileTree(
+		config.Commands["json"].Executable,
+		config.Commands["json"].Switches,
+		filename)
+	if err != nil {
+		return "", err
+	}
+	return string(canonical), nil
+}
+
+func Diff(
+	filename string,
+	options types.Options,
+	config types.Config,
+) (string, types.ChangeKind) {
 	var currentCanonical []byte
 	var headCanonical []byte
 
@@ -35,7 +51,7 @@ func Diff(filename string, options types.Options, config types.Config) string {
 	diffs := dmp.DiffMain(a, b, false)
 
 	if options.Parsetree {
-		return "| JSON comparison uses canonicalization not AST analysis"
+		return "| JSON comparison uses canonicalization not AST analysis", types.Unsupported
 	}
 
 	if options.Semantic {
@@ -43,5 +59,5 @@ func Diff(filename string, options types.Options, config types.Config) string {
 			types.JSON, options.Dumbterm, options.Minimal)
 	}
 
-	return "| No diff type specified"
+	return "| No diff type specified", types.Unsupported
 }
@@ -66,7 +66,7 @@ func TestNoSemanticDiff_SingleLineArray(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file1.name
 
-	report := json_canonical.Diff("", opts, config)
+	report, _ := json_canonical.Diff("", opts, config)
 
 	if !strings.Contains(report, "| No semantic differences detected") {
 		t.Fatalf("Failed to recognize semantic equivalence of %s and %s",
@@ -80,7 +80,7 @@ func TestNoSemanticDiff_Compactified(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file2.name
 
-	report := json_canonical.Diff("", opts, config)
+	report, _ := json_canonical.Diff("", opts, config)
 
 	if !strings.Contains(report, "| No semantic differences detected") {
 		t.Fatalf("Failed to recognize semantic equivalence of %s and %s",
@@ -94,7 +94,7 @@ func TestNoSemanticDiff_SpacesToTabs(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file3.name
 
-	report := json_canonical.Diff("", opts, config)
+	report, _ := json_canonical.Diff("", opts, config)
 
 	if !strings.Contains(report, "| No semantic differences detected") {
 		t.Fatalf("Failed to recognize semantic equivalence of %s and %s",
@@ -110,7 +110,7 @@ func TestNoParseTreeDiff(t *testing.T) {
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := json_canonical.Diff("", opts, config)
+	report, _ := json_canonical.Diff("", opts, config)
 
 	if !strings.Contains(report, "JSON comparison uses canonicalization") {
 		t.Fatalf("Failed to indicate that JSON analysis does not use parse tree")
@@ -125,7 +125,7 @@ func TestSemanticDiff_Messy(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file4.name
 
-	report := json_canonical.Diff("", opts, config)
+	report, _ := json_canonical.Diff("", opts, config)
 
 	if !strings.Contains(report, "{{+stra}}w{{-hipp}}{{+b}}e{{-d c}}") {
 		t.Fatalf("Failed to recognize colname change `num_orders`/`order_count`")
@@ -141,7 +141,7 @@ func TestSemanticDiff_Simpler(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file5.name
 
-	report := json_canonical.Diff("", opts, config)
+	report, _ := json_canonical.Diff("", opts, config)
 
 	if !strings.Contains(report, `{{-"pie"}}`) {
 		t.Fatalf("Failed to recognize change of scalar type/value")
@@ -158,7 +158,7 @@ func TestParseTreeDiff(t *testing.T) {
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := json_canonical.Diff("", opts, config)
+	report, _ := json_canonical.Diff("", opts, config)
 
 	if !strings.Contains(report, "JSON comparison uses canonicalization") {
 		t.Fatalf("Failed to indicate that JSON analysis does not use parse tree")
@@ -2,6 +2,7 @@ package python
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 
@@ -17,7 +18,89 @@ func simplifyParseTree(parseTree string) string {
 	return mod2
 }
 
-func Diff(filename string, options types.Options, config types.Config) string {
+// closeSubtree drops from the last line of a subtree the brackets that close
+// its enclosing nodes, and the comma that follows it when a sibling does,
+// leaving the subtree the same whatever comes after it.  Brackets within
+// quoted strings are not counted.
+func closeSubtree(subtree []string) []string {
+	depth := 0
+	var quote rune
+	escaped := false
+	for _, line := range subtree {
+		for _, r := range line {
+			switch {
+			case escaped:
+				escaped = false
+			case quote != 0 && r == '\\':
+				escaped = true
+			case quote != 0:
+				if r == quote {
+					quote = 0
+				}
+			case r == '\'' || r == '"':
+				quote = r
+			case strings.ContainsRune("([{", r):
+				depth++
+			case strings.ContainsRune(")]}", r):
+				depth--
+			}
+		}
+	}
+	last := strings.TrimSuffix(subtree[len(subtree)-1], ",")
+	for depth < 0 && last != "" && strings.ContainsRune(")]}", rune(last[len(last)-1])) {
+		last = strings.TrimSuffix(last[:len(last)-1], ",")
+		depth++
+	}
+	subtree[len(subtree)-1] = last
+	return subtree
+}
+
+// Subtree extracts the definition of a function, method, or class from a
+// simplified parse tree.  A dotted symbol such as `Class.method` descends
+// through the enclosing definitions in turn.
+func Subtree(tree string, symbol string) (string, bool) {
+	reDefinition := regexp.MustCompile(`^ *(Async)?(FunctionDef|ClassDef)\($`)
+	lines := strings.Split(tree, "\n")
+	for _, name := range strings.Split(symbol, ".") {
+		found := false
+		for i := 0; i+1 < len(lines); i++ {
+			if reDefinition.MatchString(lines[i]) &&
+				strings.TrimSpace(lines[i+1]) == "name='"+name+"'," {
+				lines = closeSubtree(utils.IndentedSubtree(lines, i, " "))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+// RawTree returns the parse tree of one file as the parser reports it,
+// with the positions the tree model needs
+func RawTree(filename string, config types.Config) ([]byte, error) {
+	return utils.FileTree(
+		config.Commands["python"].Executable,
+		config.Commands["python"].Switches,
+		filename)
+}
+
+// Tree returns the simplified parse tree that is compared for one file
+func Tree(filename string, config types.Config) (string, error) {
+	tree, err := RawTree(filename, config)
+	if err != nil {
+		return "", err
+	}
+	return simplifyParseTree(string(tree)), nil
+}
+
+func Diff(
+	filename string,
+	options types.Options,
+	config types.Config,
+) (string, types.ChangeKind) {
 	var currentTree []byte
 	var headTree []byte
 
@@ -44,16 +127,20 @@ func Diff(filename string, options types.Options, config types.Config) string {
 	diffs := dmp.DiffMain(headTreeString, currentTreeString, false)
 
 	if options.Parsetree {
+		if view, change := utils.TreeChanges(
+			filename, headTree, currentTree,
+			types.Python, options, config); change != types.Unsupported {
+			return view, change
+		}
 		return utils.ColorDiff(dmp, diffs,
 			types.Python, options.Dumbterm, options.Minimal)
 	}
 
 	if options.Semantic {
 		return utils.SemanticChanges(
-			dmp, diffs, filename,
-			headTree, headTreeString,
-			types.Python, options.Dumbterm, options.Minimal)
+			filename, headTree, currentTree,
+			types.Python, options, config)
 	}
 
-	return "| No diff type specified"
+	return "| No diff type specified", types.Unsupported
 }
@@ -1,6 +1,8 @@
 package python_test
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -34,11 +36,12 @@ var config = types.Config{
 var file0 = File{name: "funcs0.py", digest: "446cbb90a9860939d6a200febb87f5cf"}
 var file1 = File{name: "funcs1.py", digest: "c399625d1eda2c2ecff2747fe7258fea"}
 var file2 = File{name: "funcs2.py", digest: "009d30bfa5f9069e4922dc82601321c9"}
+var file3 = File{name: "funcs3.py", digest: "1f2db78e460030649d087d974056108e"}
 
 func TestCorrectFiles(t *testing.T) {
 	// First make sure that two sample files indeed contain an expected bodies,
 	// then make sure that these differences are judged semantically unimportant
-	files := []File{file0, file1, file2}
+	files := []File{file0, file1, file2, file3}
 	for _, file := range files {
 		if !utils.VerifyHash(file.name, file.digest) {
 			t.Fatalf("Test file %s has been changed from expected body", file.name)
@@ -52,9 +55,10 @@ func TestNoSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file1.name
 
-	report := python.Diff("", opts, config)
+	report, change := python.Diff("", opts, config)
 
-	if !strings.Contains(report, "| No semantic differences detected") {
+	if change != types.Cosmetic ||
+		!strings.Contains(report, "| No semantic differences detected") {
 		t.Fatalf("Failed to recognize semantic equivalence of %s and %s",
 			opts.Source, opts.Destination)
 	}
@@ -68,7 +72,7 @@ func TestNoParseTreeDiff(t *testing.T) {
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := python.Diff("", opts, config)
+	report, _ := python.Diff("", opts, config)
 
 	// Since we are using the opts.Dumbterm, changes would contain
 	// at least one of addition `{{+` or removal `{{-`
@@ -88,7 +92,7 @@ func TestSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file2.name
 
-	report := python.Diff("", opts, config)
+	report, _ := python.Diff("", opts, config)
 
 	if !strings.Contains(report, "-    total = a + b") {
 		t.Fatalf("Failed to recognize semantic difference in `add()` of %s and %s",
@@ -108,6 +112,30 @@ func TestSemanticDiff(t *testing.T) {
 	}
 }
 
+func TestWordDiff(t *testing.T) {
+	// Narrow the options to these test files
+	opts := options
+	opts.Source = file0.name
+	opts.Destination = file2.name
+	opts.WordDiff = true
+
+	report, _ := python.Diff("", opts, config)
+
+	// Only the tokens of the changed nodes are marked, each operator whole
+	if !strings.Contains(report, "-    ratio = a [-/-] b") {
+		t.Fatalf("Failed to mark changed token in `div()` of %s and %s",
+			opts.Source, opts.Destination)
+	}
+	if !strings.Contains(report, "+    ratio = a {+//+} b") {
+		t.Fatalf("Failed to mark changed token in `div()` of %s and %s",
+			opts.Source, opts.Destination)
+	}
+	if !strings.Contains(report, "+    total = {+b+} + {+a+}") {
+		t.Fatalf("Failed to mark changed tokens in `add()` of %s and %s",
+			opts.Source, opts.Destination)
+	}
+}
+
 func TestParseTreeDiff(t *testing.T) {
 	// Narrow the options to these test files
 	opts := options
@@ -115,18 +143,27 @@ func TestParseTreeDiff(t *testing.T) {
 	opts.Destination = file2.name
 	opts.Semantic = false
 	opts.Parsetree = true
+	opts.ContextDepth = 1
 
-	report := python.Diff("", opts, config)
+	report, _ := python.Diff("", opts, config)
 
-	// Since we are using the opts.Dumbterm, changes have ASCII markers
-	if !strings.Contains(report, "{{+Floor}}") {
+	// Changed nodes are shown within the paths to them, the rest folded
+	if !strings.Contains(report, "op=FloorDiv  line 39") {
+		t.Fatalf("Failed to parse tree difference in `div()` of %s and %s",
+			opts.Source, opts.Destination)
+	}
+	if !strings.Contains(report, "op=Div  line 39 (old)") {
 		t.Fatalf("Failed to parse tree difference in `div()` of %s and %s",
 			opts.Source, opts.Destination)
 	}
-	if !strings.Contains(report, "{{-a}}{{+b}}") {
+	if !strings.Contains(report, "id('a' -> 'b')") {
 		t.Fatalf("Failed to parse tree difference in `add()` of %s and %s",
 			opts.Source, opts.Destination)
 	}
+	if !strings.Contains(report, "FunctionDef ...  lines 7-10") {
+		t.Fatalf("Failed to fold unchanged `sub()` of %s and %s",
+			opts.Source, opts.Destination)
+	}
 }
 
 func TestNoSpuriousSemantic(t *testing.T) {
@@ -135,7 +172,7 @@ func TestNoSpuriousSemantic(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file2.name
 
-	report := python.Diff("", opts, config)
+	report, _ := python.Diff("", opts, config)
 
 	if strings.Contains(report, "a - b") {
 		t.Fatalf("Misrecognized semantic difference in `sub()` of %s and %s",
@@ -146,3 +183,80 @@ func TestNoSpuriousSemantic(t *testing.T) {
 			opts.Source, opts.Destination)
 	}
 }
+
+func TestBidirectionalLines(t *testing.T) {
+	// The comment atop file3 shifts every line, so that the cosmetic change
+	// on old line 15 falls on the new line of the semantic change to `pow()`
+	opts := options
+	opts.Source = file0.name
+	opts.Destination = file3.name
+
+	report, _ := python.Diff("", opts, config)
+
+	if !strings.Contains(report, "+    power = b**a") {
+		t.Fatalf("Failed to recognize semantic difference in `pow()` of %s and %s",
+			opts.Source, opts.Destination)
+	}
+	if !strings.Contains(report, "+    big = abs(big)") {
+		t.Fatalf("Failed to recognize statement added to `more()` of %s and %s",
+			opts.Source, opts.Destination)
+	}
+	if strings.Contains(report, "a-b") {
+		t.Fatalf("Misrecognized semantic difference in `sub()` of %s and %s",
+			opts.Source, opts.Destination)
+	}
+}
+
+func TestSubtree(t *testing.T) {
+	tree0, err := python.Tree(file0.name, config)
+	if err != nil {
+		t.Fatalf("Unable to create parse tree of %s", file0.name)
+	}
+	tree1, err := python.Tree(file1.name, config)
+	if err != nil {
+		t.Fatalf("Unable to create parse tree of %s", file1.name)
+	}
+
+	add0, found := python.Subtree(tree0, "add")
+	if !found || !strings.HasPrefix(add0, "FunctionDef(\n   name='add',") {
+		t.Fatalf("Failed to extract function `add` from %s", file0.name)
+	}
+	add1, _ := python.Subtree(tree1, "add")
+	if add0 != add1 {
+		t.Fatalf("Function `add` differs between %s and %s", file0.name, file1.name)
+	}
+	if _, found := python.Subtree(tree0, "nonesuch"); found {
+		t.Fatalf("Found function `nonesuch` that does not exist")
+	}
+}
+
+func TestSubtreeSibling(t *testing.T) {
+	// Appending a definition changes only what closes the one before it
+	dir := t.TempDir()
+	bodies := []string{
+		"class Calc:\n    def add(self, a, b):\n        return a + b\n",
+		"class Calc:\n    def add(self, a, b):\n        return a + b\n\n" +
+			"    def sub(self, a, b):\n        return a - b\n\n" +
+			"def mul(a, b):\n    return a * b\n",
+	}
+	var subtrees []string
+	for i, body := range bodies {
+		name := filepath.Join(dir, "calc"+string(rune('0'+i))+".py")
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatalf("Unable to write %s", name)
+		}
+		tree, err := python.Tree(name, config)
+		if err != nil {
+			t.Fatalf("Unable to create parse tree of %s", name)
+		}
+		subtree, found := python.Subtree(tree, "Calc.add")
+		if !found || !strings.HasSuffix(subtree, "end_col_offset=?)") {
+			t.Fatalf("Failed to extract method `Calc.add` from %s:\n%s", name, subtree)
+		}
+		subtrees = append(subtrees, subtree)
+	}
+	if subtrees[0] != subtrees[1] {
+		t.Fatalf("Method `Calc.add` differs once a sibling is appended:\n%s\n%s",
+			subtrees[0], subtrees[1])
+	}
+}
@@ -2,6 +2,7 @@ package ruby
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 
@@ -18,7 +19,80 @@ func simplifyParseTree(parseTree string) string {
 	return mod3
 }
 
-func Diff(filename string, options types.Options, config types.Config) string {
+// RawTree returns the parse tree of one file as the parser reports it,
+// with the positions the tree model needs
+func RawTree(filename string, config types.Config) ([]byte, error) {
+	return utils.FileTree(
+		config.Commands["ruby"].Executable,
+		config.Commands["ruby"].Switches,
+		filename)
+}
+
+// Tree returns the simplified parse tree that is compared for one file
+func Tree(filename string, config types.Config) (string, error) {
+	tree, err := RawTree(filename, config)
+	if err != nil {
+		return "", err
+	}
+	return simplifyParseTree(string(tree)), nil
+}
+
+// nodeSubtree returns the node at lines[start] with its attributes (the
+// `+-` lines at the same column) and everything nested more deeply
+func nodeSubtree(lines []string, start int) []string {
+	depth := utils.IndentOf(lines[start], " |")
+	subtree := []string{lines[start][depth:]}
+	for _, line := range lines[start+1:] {
+		indent := utils.IndentOf(line, " |")
+		if strings.TrimSpace(line) == "" || indent < depth {
+			break
+		}
+		if indent == depth && !strings.HasPrefix(line[indent:], "+-") {
+			break
+		}
+		subtree = append(subtree, line[depth:])
+	}
+	return subtree
+}
+
+// Subtree extracts the definition of a method, class, or module from a
+// simplified parse tree.  A dotted symbol such as `Class.method` descends
+// through the enclosing definitions in turn.
+func Subtree(tree string, symbol string) (string, bool) {
+	reDefinition := regexp.MustCompile(`^[ |]*@ NODE_(DEFN|DEFS|CLASS|MODULE)\b`)
+	reName := regexp.MustCompile(`nd_mid: :(\S+)`)
+	lines := strings.Split(tree, "\n")
+	for _, name := range strings.Split(symbol, ".") {
+		found := false
+		for i := range lines {
+			if !reDefinition.MatchString(lines[i]) {
+				continue
+			}
+			subtree := nodeSubtree(lines, i)
+			// The first name within a definition is the one it declares
+			for _, line := range subtree[1:] {
+				if m := reName.FindStringSubmatch(line); m != nil {
+					found = m[1] == name
+					break
+				}
+			}
+			if found {
+				lines = subtree
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+func Diff(
+	filename string,
+	options types.Options,
+	config types.Config,
+) (string, types.ChangeKind) {
 	var headTree []byte
 	var currentTree []byte
 
@@ -45,16 +119,20 @@ func Diff(filename string, options types.Options, config types.Config) string {
 	diffs := dmp.DiffMain(headTreeString, currentTreeString, false)
 
 	if options.Parsetree {
+		if view, change := utils.TreeChanges(
+			filename, headTree, currentTree,
+			types.Ruby, options, config); change != types.Unsupported {
+			return view, change
+		}
 		return utils.ColorDiff(dmp, diffs,
 			types.Ruby, options.Dumbterm, options.Minimal)
 	}
 
 	if options.Semantic {
 		return utils.SemanticChanges(
-			dmp, diffs, filename,
-			headTree, headTreeString,
-			types.Ruby, options.Dumbterm, options.Minimal)
+			filename, headTree, currentTree,
+			types.Ruby, options, config)
 	}
 
-	return "| No diff type specified"
+	return "| No diff type specified", types.Unsupported
 }
@@ -52,7 +52,7 @@ func TestNoSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file3.name
 
-	report := ruby.Diff("", opts, config)
+	report, _ := ruby.Diff("", opts, config)
 
 	if !strings.Contains(report, "| No semantic differences detected") {
 		t.Fatalf("Failed to recognize semantic equivalence of %s and %s",
@@ -68,7 +68,7 @@ func TestNoParseTreeDiff(t *testing.T) {
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := ruby.Diff("", opts, config)
+	report, _ := ruby.Diff("", opts, config)
 
 	// Since we are using the opts.Dumbterm, changes would contain
 	// at least one of addition `{{+` or removal `{{-`
@@ -88,7 +88,7 @@ func TestSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file4.name
 
-	report := ruby.Diff("", opts, config)
+	report, _ := ruby.Diff("", opts, config)
 
 	if !strings.Contains(report, "-puts mod5? 1..100") {
 		t.Fatalf("Failed to recognize semantic difference between %s and %s",
@@ -108,20 +108,18 @@ func TestParseTreeDiff(t *testing.T) {
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := ruby.Diff("", opts, config)
+	report, _ := ruby.Diff("", opts, config)
 
-	// Since we are using the opts.Dumbterm, changes have ASCII markers
-	if !strings.Contains(report, "{{-10}}{{+5}}") {
+	if !strings.Contains(report, "100 -> 50") {
 		t.Fatalf("Failed to parse tree difference between %s and %s",
 			opts.Source, opts.Destination)
 	}
 	// Other than the one change, should have no change markers
-	minusOneChange := strings.ReplaceAll(report, "{{-10}}{{+5}}", "")
-	if strings.Contains(minusOneChange, "{{-") {
+	if strings.Contains(report, "| -") {
 		t.Fatalf("Found spurious parse tree difference between %s and %s",
 			opts.Source, opts.Destination)
 	}
-	if strings.Contains(minusOneChange, "{{+") {
+	if strings.Contains(report, "| +") {
 		t.Fatalf("Found spurious parse tree difference between %s and %s",
 			opts.Source, opts.Destination)
 	}
@@ -133,7 +131,7 @@ func TestNoSpuriousSemantic(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file3.name
 
-	report := ruby.Diff("", opts, config)
+	report, _ := ruby.Diff("", opts, config)
 
 	if strings.Contains(report, "puts mod5? 1..100") {
 		t.Fatalf("Misrecognized semantic difference between %s and %s",
@@ -144,3 +142,42 @@ func TestNoSpuriousSemantic(t *testing.T) {
 			opts.Source, opts.Destination)
 	}
 }
+
+var rubyTree = `@ NODE_SCOPE
++- nd_tbl: (empty)
++- nd_body:
+    @ NODE_CLASS
+    +- nd_cpath:
+    |   @ NODE_COLON2
+    |   +- nd_mid: :Foo
+    +- nd_body:
+        @ NODE_SCOPE
+        +- nd_body:
+            @ NODE_DEFN
+            +- nd_mid: :bar
+            +- nd_defn:
+                @ NODE_SCOPE
+                +- nd_body:
+                    @ NODE_LIT
+                    +- nd_lit: 1
+            @ NODE_DEFN
+            +- nd_mid: :baz
+            +- nd_defn:
+                @ NODE_SCOPE`
+
+func TestSubtree(t *testing.T) {
+	want := `@ NODE_DEFN
++- nd_mid: :bar
++- nd_defn:
+    @ NODE_SCOPE
+    +- nd_body:
+        @ NODE_LIT
+        +- nd_lit: 1`
+	subtree, found := ruby.Subtree(rubyTree, "Foo.bar")
+	if !found || subtree != want {
+		t.Fatalf("Failed to extract method `Foo.bar`, got:\n%s", subtree)
+	}
+	if _, found := ruby.Subtree(rubyTree, "Foo.nonesuch"); found {
+		t.Fatalf("Found method `Foo.nonesuch` that does not exist")
+	}
+}
@@ -3,6 +3,8 @@ package sql
 import (
 	"bytes"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 
@@ -10,12 +12,13 @@ import (
 	"github.com/atlantistechnology/sdt/pkg/utils"
 )
 
-// colorDiff converts (DiffMatchPatch, []Diff) into colored text report
+// colorDiff converts (DiffMatchPatch, []Diff) into colored text report,
+// judging any difference but whitespace semantic
 func colorDiff(
 	dmp *diffmatchpatch.DiffMatchPatch,
 	diffs []diffmatchpatch.Diff,
 	dumbterm bool,
-	minimal bool) string {
+	minimal bool) (string, types.ChangeKind) {
 
 	var buff bytes.Buffer
 	// Tool `sqlformat` doesn't normalize whitespace completely
@@ -60,13 +63,130 @@ func colorDiff(
 		}
 	}
 	if changed {
-		return utils.BufferToDiff(buff, true, dumbterm, minimal)
+		return utils.BufferToDiff(buff, true, dumbterm, minimal), types.Semantic
 	}
 
-	return "| No semantic differences detected"
+	return types.NoSemanticDiff, types.Cosmetic
 }
 
-func Diff(filename string, options types.Options, config types.Config) string {
+var (
+	reInList = regexp.MustCompile(`(?i)\bIN\s*\(`)
+	reSelect = regexp.MustCompile(`(?i)\bSELECT\b`)
+)
+
+// listEnd finds the parenthesis closing a list, given the text following
+// the one opening it, skipping nested parentheses and any within quotes.
+// It is -1 if the list is never closed.
+func listEnd(text string) int {
+	var quote rune
+	depth := 0
+	for i, c := range text {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// splitValues divides a list of values at the commas outside of quotes and
+// nested parentheses
+func splitValues(list string) []string {
+	var values []string
+	var quote rune
+	depth := 0
+	start := 0
+	for i, c := range list {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			values = append(values, strings.TrimSpace(list[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, strings.TrimSpace(list[start:]))
+}
+
+// sortInLists puts the values listed by each IN operator in order, if the
+// configuration counts them as unordered, since the order has no meaning
+func sortInLists(canonical []byte, config types.Config) []byte {
+	unordered := false
+	for _, kind := range config.UnorderedIn("sql") {
+		unordered = unordered || strings.EqualFold(kind, "IN")
+	}
+	if !unordered {
+		return canonical
+	}
+	// A subquery is left in order, though IN lists within it are sorted
+	var sorted strings.Builder
+	text := string(canonical)
+	for {
+		open := reInList.FindStringIndex(text)
+		if open == nil {
+			break
+		}
+		sorted.WriteString(text[:open[1]])
+		text = text[open[1]:]
+		end := listEnd(text)
+		if end < 0 || reSelect.MatchString(text[:end]) {
+			continue
+		}
+		values := splitValues(text[:end])
+		sort.Strings(values)
+		sorted.WriteString(strings.Join(values, ", "))
+		text = text[end:]
+	}
+	sorted.WriteString(text)
+	return []byte(sorted.String())
+}
+
+// Tree returns the canonical SQL that is compared for one file.  Since
+// `sqlformat` doesn't normalize whitespace completely, trailing spaces and
+// blank lines are dropped here as they are ignored by colorDiff()
+func Tree(filename string, config types.Config) (string, error) {
+	canonical, err := utils.FileTree(
+		config.Commands["sql"].Executable,
+		config.Commands["sql"].Switches,
+		filename)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	canonical = sortInLists(canonical, config)
+	for _, line := range strings.Split(string(canonical), "\n") {
+		line = strings.TrimRight(line, "\r\t ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func Diff(
+	filename string,
+	options types.Options,
+	config types.Config,
+) (string, types.ChangeKind) {
 	var currentCanonical []byte
 	var headCanonical []byte
 
@@ -88,18 +208,18 @@ func Diff(filename string, options types.Options, config types.Config) string {
 
 	// Perform the diff between the versions
 	// Our canonicalizer isn't always consistent with trailing spaces
-	a := string(headCanonical)
-	b := string(currentCanonical)
+	a := string(sortInLists(headCanonical, config))
+	b := string(sortInLists(currentCanonical, config))
 	dmp := diffmatchpatch.New()
 	diffs := dmp.DiffMain(a, b, false)
 
 	if options.Parsetree {
-		return "| SQL comparison uses canonicalization not AST analysis"
+		return "| SQL comparison uses canonicalization not AST analysis", types.Unsupported
 	}
 
 	if options.Semantic {
 		return colorDiff(dmp, diffs, options.Dumbterm, options.Minimal)
 	}
 
-	return "| No diff type specified"
+	return "| No diff type specified", types.Unsupported
 }
@@ -1,6 +1,8 @@
 package sql_test
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -52,7 +54,7 @@ func TestNoSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file1.name
 
-	report := sql.Diff("", opts, config)
+	report, _ := sql.Diff("", opts, config)
 
 	if !strings.Contains(report, "| No semantic differences detected") {
 		t.Fatalf("Failed to recognize semantic equivalence of %s and %s",
@@ -68,7 +70,7 @@ func TestNoParseTreeDiff(t *testing.T) {
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := sql.Diff("", opts, config)
+	report, _ := sql.Diff("", opts, config)
 
 	if !strings.Contains(report, "SQL comparison uses canonicalization") {
 		t.Fatalf("Failed to indicate that SQL analysis does not use parse tree")
@@ -81,7 +83,7 @@ func TestSemanticDiff(t *testing.T) {
 	opts.Source = file0.name
 	opts.Destination = file2.name
 
-	report := sql.Diff("", opts, config)
+	report, _ := sql.Diff("", opts, config)
 
 	if !strings.Contains(report, "{{-num_}}") {
 		t.Fatalf("Failed to recognize colname change `num_orders`/`order_count`")
@@ -101,7 +103,7 @@ func TestParseTreeDiff(t *testing.T) {
 	opts.Semantic = false
 	opts.Parsetree = true
 
-	report := sql.Diff("", opts, config)
+	report, _ := sql.Diff("", opts, config)
 
 	if !strings.Contains(report, "SQL comparison uses canonicalization") {
 		t.Fatalf("Failed to indicate that SQL analysis does not use parse tree")
@@ -114,7 +116,7 @@ func TestNoSpuriousSemantic(t *testing.T) {
 	opts.Source = file1.name
 	opts.Destination = file2.name
 
-	report := sql.Diff("", opts, config)
+	report, _ := sql.Diff("", opts, config)
 
 	// Lines with added or removed comments not significant for comments only
 	if strings.Contains(report, "-- Number of books") {
@@ -122,3 +124,30 @@ func TestNoSpuriousSemantic(t *testing.T) {
 			opts.Source, opts.Destination)
 	}
 }
+
+func TestSortInLists(t *testing.T) {
+	// The canonicalizer is bypassed, so only the sorting of IN lists applies
+	commands := map[string]types.Command{}
+	for name, command := range types.Commands {
+		commands[name] = command
+	}
+	commands["sql"] = types.Command{Executable: "cat"}
+	cfg := config
+	cfg.Commands = commands
+
+	name := filepath.Join(t.TempDir(), "in.sql")
+	body := "SELECT a FROM t WHERE b IN (f(2, 1), 'x)', (3))\n" +
+		"AND c IN (SELECT d FROM u WHERE e IN (2, 1))\n"
+	if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+		t.Fatalf("Unable to write %s", name)
+	}
+	tree, err := sql.Tree(name, cfg)
+	if err != nil {
+		t.Fatalf("Unable to read %s", name)
+	}
+	want := "SELECT a FROM t WHERE b IN ('x)', (3), f(2, 1))\n" +
+		"AND c IN (SELECT d FROM u WHERE e IN (1, 2))"
+	if tree != want {
+		t.Fatalf("Sorted IN lists as:\n%s\nrather than:\n%s", tree, want)
+	}
+}
@@ -0,0 +1,292 @@
+package treediff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// scopeRules describe where one language binds and uses local names.  A
+// function is a scope, and a name bound anywhere in it is local throughout
+// it; block scopes within a function are not distinguished.
+type scopeRules struct {
+	// scope is true of a node whose locals are renamed, i.e. a function
+	scope func(n *Node) bool
+	// outside is true of a part of a scope evaluated in the enclosing one,
+	// such as a default value or the function's own name
+	outside func(n *Node) bool
+	// occurrence finds the leaf naming a variable at a node, if the node is
+	// a use of a variable, and whether the use binds it
+	occurrence func(n *Node) (*Node, bool)
+	// declared lists the names a node declares as not local to its scope
+	declared func(n *Node) []string
+}
+
+var alphaRules = map[types.ParseType]scopeRules{
+	types.Python:     {pyScope, pyOutside, pyOccurrence, pyDeclared},
+	types.Go:         {goScope, goOutside, goOccurrence, noneDeclared},
+	types.JavaScript: {jsScope, jsOutside, jsOccurrence, noneDeclared},
+}
+
+// CanonicalizeLocals replaces the names of the local variables and
+// parameters of each function by names given by the order in which they
+// are first bound, so that renaming a local consistently throughout its
+// function leaves the tree as it was.  The names as written remain in
+// Original, and Diff reports them as respellings.  Languages without rules
+// for their scopes are left unchanged, and false returned.
+func CanonicalizeLocals(root *Node, parseType types.ParseType) bool {
+	rules, found := alphaRules[parseType]
+	if !found {
+		return false
+	}
+	rules.rename(root, nil)
+	root.Finish()
+	return true
+}
+
+// canonical is true of a label CanonicalizeLocals gave
+func canonical(n *Node) bool {
+	return n.Original != "" && strings.HasPrefix(n.Label, "$")
+}
+
+// ConsistentRenames keeps as respellings only those renames of locals that
+// were made consistently.  Where a local's canonical name is updated, as
+// when some but not all of its uses were renamed, and one now refers to
+// another variable, its other renames become updates too.
+func ConsistentRenames(edits []Edit) []Edit {
+	broken := map[string]bool{}
+	for _, edit := range edits {
+		if edit.Op != Update {
+			continue
+		}
+		for _, n := range []*Node{edit.Src, edit.Dst} {
+			if canonical(n) {
+				broken[n.Label+" < "+scopeOf(n)] = true
+			}
+		}
+	}
+	checked := make([]Edit, len(edits))
+	for i, edit := range edits {
+		checked[i] = edit
+		if edit.Op == Respell && canonical(edit.Src) &&
+			(broken[edit.Src.Label+" < "+scopeOf(edit.Src)] ||
+				broken[edit.Dst.Label+" < "+scopeOf(edit.Dst)]) {
+			checked[i].Op = Update
+		}
+	}
+	return checked
+}
+
+// rename replaces the names of locals within a node, given the chain of
+// enclosing scopes, each mapping the names bound in it to canonical names
+func (r scopeRules) rename(n *Node, chain []map[string]string) {
+	if r.outside(n) && len(chain) > 0 {
+		chain = chain[:len(chain)-1]
+	}
+	if r.scope(n) {
+		locals := map[string]string{}
+		nonlocal := map[string]bool{}
+		r.bind(n, locals, nonlocal, len(chain)+1)
+		for name := range nonlocal {
+			delete(locals, name)
+		}
+		chain = append(chain[:len(chain):len(chain)], locals)
+	} else if leaf, _ := r.occurrence(n); leaf != nil {
+		for i := len(chain) - 1; i >= 0; i-- {
+			if canonical, found := chain[i][leaf.Label]; found {
+				if leaf.Original == "" {
+					leaf.Original = leaf.Label
+				}
+				leaf.Label = canonical
+				break
+			}
+		}
+	}
+	for _, child := range n.Children {
+		r.rename(child, chain)
+	}
+}
+
+// bind numbers the names bound within a scope, in the order first bound,
+// skipping nested scopes and the parts evaluated outside of it
+func (r scopeRules) bind(n *Node, locals map[string]string, nonlocal map[string]bool, depth int) {
+	for _, child := range n.Children {
+		if r.outside(child) || r.scope(child) {
+			continue
+		}
+		if leaf, binds := r.occurrence(child); binds {
+			if _, found := locals[leaf.Label]; !found {
+				locals[leaf.Label] = fmt.Sprintf("$%d.%d", depth, len(locals)+1)
+			}
+		}
+		for _, name := range r.declared(child) {
+			nonlocal[name] = true
+		}
+		r.bind(child, locals, nonlocal, depth)
+	}
+}
+
+func noneDeclared(n *Node) []string {
+	return nil
+}
+
+//-- Python
+
+func pyScope(n *Node) bool {
+	switch n.Kind {
+	case "FunctionDef", "AsyncFunctionDef", "Lambda":
+		return true
+	}
+	return false
+}
+
+// Decorators, annotations, and defaults are evaluated where a function is
+// defined.  Note that a parameter may be passed by keyword, so renaming
+// one is local only if no caller does so.
+func pyOutside(n *Node) bool {
+	switch n.Field {
+	case "decorator_list", "returns", "annotation", "defaults", "kw_defaults":
+		return n.Parent != nil
+	}
+	return false
+}
+
+func pyOccurrence(n *Node) (*Node, bool) {
+	switch n.Kind {
+	case "Name":
+		leaf, ctx := child(n, "id"), child(n, "ctx")
+		return leaf, leaf != nil && ctx != nil && ctx.Kind != "Load"
+	case "arg":
+		leaf := child(n, "arg")
+		return leaf, leaf != nil
+	case "ExceptHandler":
+		leaf := child(n, "name")
+		return leaf, leaf != nil
+	}
+	return nil, false
+}
+
+// pyDeclared lists the names of a `global` or `nonlocal` statement, whose
+// elements are quoted as the labels of names are
+func pyDeclared(n *Node) []string {
+	if n.Kind != "Global" && n.Kind != "Nonlocal" {
+		return nil
+	}
+	var names []string
+	for _, d := range n.PreOrder()[1:] {
+		for _, name := range strings.Split(strings.Trim(d.Label, "[]"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+//-- Go
+
+func goScope(n *Node) bool {
+	return n.Kind == "FuncDecl" || n.Kind == "FuncLit"
+}
+
+// The name of a function belongs to its package
+func goOutside(n *Node) bool {
+	return n.Field == "Name" && n.Parent != nil && n.Parent.Kind == "FuncDecl"
+}
+
+// goBinding is true of an identifier a parameter, result, receiver,
+// variable declaration, short variable declaration, or range clause binds
+func goBinding(n *Node) bool {
+	parent := n.Parent
+	if parent == nil {
+		return false
+	}
+	switch {
+	case parent.Field == "Names" && parent.Parent != nil:
+		if parent.Parent.Kind == "ValueSpec" {
+			return true
+		}
+		// Fields of structs and methods of interfaces are not variables
+		for p := parent.Parent; p != nil; p = p.Parent {
+			if p.Kind == "FieldList" {
+				return p.Parent != nil &&
+					(p.Parent.Kind == "FuncType" || p.Parent.Kind == "FuncDecl")
+			}
+		}
+		return false
+	case parent.Kind == "[]" && parent.Field == "Lhs":
+		tok := child(parent.Parent, "Tok")
+		return tok != nil && tok.Label == ":="
+	case parent.Kind == "RangeStmt" && (n.Field == "Key" || n.Field == "Value"):
+		tok := child(parent, "Tok")
+		return tok != nil && tok.Label == ":="
+	}
+	return false
+}
+
+func goOccurrence(n *Node) (*Node, bool) {
+	if n.Kind != "Ident" || n.Field == "Sel" || n.Parent == nil {
+		return nil, false
+	}
+	// Keys of composite literals name fields, and labels are not variables
+	switch {
+	case n.Field == "Key" && n.Parent.Kind == "KeyValueExpr":
+		return nil, false
+	case n.Field == "Label" &&
+		(n.Parent.Kind == "LabeledStmt" || n.Parent.Kind == "BranchStmt"):
+		return nil, false
+	}
+	leaf := child(n, "Name")
+	if leaf == nil || leaf.Label == `"_"` {
+		return nil, false
+	}
+	return leaf, goBinding(n)
+}
+
+//-- JavaScript
+
+func jsScope(n *Node) bool {
+	switch n.Kind {
+	case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression":
+		return true
+	}
+	return false
+}
+
+// The name of a declared function belongs to the enclosing scope
+func jsOutside(n *Node) bool {
+	return n.Field == "id" && n.Parent != nil && jsScope(n.Parent)
+}
+
+// jsComputed is true of a member or property named by an expression
+func jsComputed(n *Node) bool {
+	computed := child(n, "computed")
+	return computed != nil && computed.Label == "true"
+}
+
+func jsOccurrence(n *Node) (*Node, bool) {
+	if n.Kind != "Identifier" {
+		return nil, false
+	}
+	leaf, parent := child(n, "name"), n.Parent
+	if leaf == nil || parent == nil {
+		return nil, false
+	}
+	switch {
+	// Names of properties, methods, and labels are not variables
+	case n.Field == "property" && parent.Kind == "MemberExpression" && !jsComputed(parent):
+		return nil, false
+	case n.Field == "key" && !jsComputed(parent):
+		return nil, false
+	case n.Field == "label":
+		return nil, false
+	case n.Field == "id" && parent.Kind == "VariableDeclarator",
+		parent.Kind == "[]" && parent.Field == "params",
+		n.Field == "param" && parent.Kind == "CatchClause",
+		n.Field == "left" && parent.Kind == "AssignmentPattern",
+		n.Field == "argument" && parent.Kind == "RestElement":
+		return leaf, true
+	}
+	return leaf, false
+}
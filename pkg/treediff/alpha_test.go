@@ -0,0 +1,153 @@
+package treediff_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// A function of one parameter returning the sum of two names
+const pyAdd = `Module(
+   body=[
+      FunctionDef(
+         name='f',
+         args=arguments(
+            args=[
+               arg(
+                  arg='%s',
+                  lineno=1)]),
+         body=[
+            Return(
+               value=BinOp(
+                  left=Name(
+                     id='%s',
+                     ctx=Load(),
+                     lineno=2),
+                  op=Add(),
+                  right=Name(
+                     id='%s',
+                     ctx=Load(),
+                     lineno=2),
+                  lineno=2),
+               lineno=2)],
+         lineno=1)])`
+
+func pyAddTree(t *testing.T, param string, left string, right string) *treediff.Node {
+	root := fixtureTree(t, types.Python, pyAdd, param, left, right)
+	treediff.CanonicalizeLocals(root, types.Python)
+	return root
+}
+
+func TestCanonicalizeLocals(t *testing.T) {
+	cases := []struct {
+		src      *treediff.Node
+		dst      *treediff.Node
+		category treediff.Category
+	}{
+		// The parameter is renamed throughout
+		{pyAddTree(t, "'x'", "'x'", "'y'"), pyAddTree(t, "'a'", "'a'", "'y'"),
+			treediff.LocalRename},
+		// A global is renamed
+		{pyAddTree(t, "'x'", "'x'", "'y'"), pyAddTree(t, "'x'", "'x'", "'z'"),
+			treediff.Rename},
+		// One use of the parameter is left, so now refers to a global
+		{pyAddTree(t, "'x'", "'x'", "'x'"), pyAddTree(t, "'a'", "'a'", "'x'"),
+			treediff.Rename},
+	}
+	for _, c := range cases {
+		edits := treediff.ConsistentRenames(treediff.Diff(c.src, c.dst))
+		if category := treediff.ClassifyAll(edits); category != c.category {
+			t.Fatalf("Classified %s as %s rather than %s",
+				describe(edits), category, c.category)
+		}
+		for _, edit := range edits {
+			if c.category != treediff.LocalRename && !treediff.Semantic(edit) {
+				t.Fatalf("Inconsistent rename kept as %s", edit)
+			}
+		}
+	}
+}
+
+// A Go function binding a local, labelling a loop, and naming a field of a
+// composite literal, each of which may share a name
+const goLocals = `SrcLn | Node
+00000 | *ast.File
+00001 |   Name: *ast.Ident
+00001 |     Name: "p"
+00001 |     Obj: nil
+00001 |   Decls: []ast.Decl (len = 1)
+00001 |     0: *ast.FuncDecl
+00001 |       Name: *ast.Ident
+00003 |         Name: "f"
+00003 |         Obj: nil
+00003 |       Type: *ast.FuncType
+00003 |         Params: *ast.FieldList
+00003 |           List: nil
+00003 |       Body: *ast.BlockStmt
+00003 |         List: []ast.Stmt (len = 3)
+00003 |           0: *ast.AssignStmt
+00003 |             Lhs: []ast.Expr (len = 1)
+00003 |               0: *ast.Ident
+00004 |                 Name: "%[1]s"
+00004 |                 Obj: nil
+00004 |             Tok: :=
+00004 |             Rhs: []ast.Expr (len = 1)
+00004 |               0: *ast.BasicLit
+00004 |                 Kind: INT
+00004 |                 Value: "1"
+00004 |           1: *ast.LabeledStmt
+00004 |             Label: *ast.Ident
+00005 |               Name: "%[2]s"
+00005 |               Obj: nil
+00005 |             Stmt: *ast.ForStmt
+00006 |               Body: *ast.BlockStmt
+00006 |                 List: []ast.Stmt (len = 1)
+00006 |                   0: *ast.BranchStmt
+00007 |                     Tok: break
+00007 |                     Label: *ast.Ident
+00007 |                       Name: "%[2]s"
+00007 |                       Obj: nil
+00008 |           2: *ast.ReturnStmt
+00009 |             Results: []ast.Expr (len = 1)
+00009 |               0: *ast.CompositeLit
+00009 |                 Type: *ast.Ident
+00009 |                   Name: "T"
+00009 |                   Obj: nil
+00009 |                 Elts: []ast.Expr (len = 1)
+00009 |                   0: *ast.KeyValueExpr
+00009 |                     Key: *ast.Ident
+00009 |                       Name: "%[3]s"
+00009 |                       Obj: nil
+00009 |                     Value: *ast.Ident
+00009 |                       Name: "%[1]s"
+00009 |                       Obj: nil
+`
+
+func goLocalsTree(t *testing.T, local string, label string, key string) *treediff.Node {
+	root := fixtureTree(t, types.Go, goLocals, local, label, key)
+	treediff.CanonicalizeLocals(root, types.Go)
+	return root
+}
+
+func TestCanonicalizeGoLocals(t *testing.T) {
+	src := goLocalsTree(t, "x", "x", "x")
+	cases := []struct {
+		dst      *treediff.Node
+		category treediff.Category
+	}{
+		// The local alone is renamed, as the field and label are not it
+		{goLocalsTree(t, "y", "x", "x"), treediff.LocalRename},
+		// The field of the literal is another field
+		{goLocalsTree(t, "y", "x", "y"), treediff.Rename},
+		// The loop has another label
+		{goLocalsTree(t, "y", "y", "x"), treediff.Rename},
+	}
+	for _, c := range cases {
+		edits := treediff.ConsistentRenames(treediff.Diff(src, c.dst))
+		if category := treediff.ClassifyAll(edits); category != c.category {
+			t.Fatalf("Classified %s as %s rather than %s",
+				describe(edits), category, c.category)
+		}
+	}
+}
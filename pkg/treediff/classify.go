@@ -0,0 +1,174 @@
+package treediff
+
+import "strings"
+
+// Category describes the nature of a change.  Categories are ordered from
+// least to most significant, so a mixture of changes takes the greatest.
+type Category int8
+
+const (
+	Layout       Category = iota // Whitespace or formatting only
+	Comment                      // Comments only
+	Docstring                    // Documentation strings only
+	Spelling                     // Literals written differently, with the same value
+	Moved                        // Declarations moved where order is not significant
+	LocalRename                  // Local variables renamed consistently
+	MappedRename                 // Identifiers renamed as the user asked
+	Literal                      // Values of literals
+	Rename                       // Names of identifiers
+	Reorder                      // Nodes moved without other change
+	Structural                   // Nodes added or removed, or operators changed
+)
+
+func (c Category) String() string {
+	switch c {
+	case Layout:
+		return "whitespace/layout"
+	case Comment:
+		return "comment-only"
+	case Docstring:
+		return "docstring-only"
+	case Spelling:
+		return "literal spelling"
+	case Moved:
+		return "moved"
+	case LocalRename:
+		return "local rename"
+	case MappedRename:
+		return "mapped rename"
+	case Literal:
+		return "literal value change"
+	case Rename:
+		return "identifier rename"
+	case Reorder:
+		return "reordering"
+	}
+	return "structural/control-flow"
+}
+
+// Kinds of nodes, across the parsers, whose labels are literal values.
+// Tree-sitter kinds ending in "_literal" are recognized by their suffix.
+var literalKinds = map[string]bool{
+	// Python
+	"Constant": true, "Num": true, "Str": true, "Bytes": true,
+	// Go
+	"BasicLit": true,
+	// JavaScript
+	"Literal": true, "TemplateElement": true,
+	// Ruby
+	"NODE_LIT": true, "NODE_STR": true, "NODE_XSTR": true, "NODE_INTEGER": true,
+	"NODE_FLOAT": true, "NODE_RATIONAL": true, "NODE_IMAGINARY": true,
+	// Tree-sitter
+	"string": true, "number": true, "integer": true, "float": true,
+	"system_lib_string": true,
+}
+
+// Attributes, across the parsers, whose values name something
+var identifierFields = map[string]bool{
+	// Python and JavaScript
+	"id": true, "name": true, "arg": true, "attr": true, "asname": true,
+	// Go
+	"Name": true,
+	// Ruby
+	"nd_vid": true, "nd_mid": true, "nd_cname": true,
+}
+
+// Kinds of statements consisting of a bare expression
+var expressionStatements = map[string]bool{
+	"Expr": true, "expression_statement": true,
+}
+
+// owner is the node an attribute belongs to, or the node itself
+func owner(n *Node) *Node {
+	if n.Field != "" && n.Field == n.Kind && n.Parent != nil {
+		return n.Parent
+	}
+	return n
+}
+
+func isComment(n *Node) bool {
+	return strings.Contains(strings.ToLower(n.Kind), "comment")
+}
+
+func isLiteral(n *Node) bool {
+	kind := owner(n).Kind
+	return literalKinds[kind] || strings.HasSuffix(kind, "_literal")
+}
+
+func isIdentifier(n *Node) bool {
+	if n.Field == n.Kind && identifierFields[n.Field] {
+		return true
+	}
+	return strings.HasSuffix(strings.ToLower(n.Kind), "identifier")
+}
+
+// isDocstring is true of a string literal standing alone as a statement,
+// or of such a statement, as Python uses for documentation
+func isDocstring(n *Node) bool {
+	if expressionStatements[n.Kind] && len(n.Children) == 1 {
+		n = n.Children[0]
+		for len(n.Children) == 1 && n.Label == "" {
+			n = n.Children[0]
+		}
+	}
+	if !isLiteral(n) || !strings.ContainsAny(n.Label, `'"`) {
+		return false
+	}
+	for p := owner(n).Parent; p != nil; p = p.Parent {
+		if expressionStatements[p.Kind] {
+			return true
+		}
+		if !isLiteral(p) {
+			return false
+		}
+	}
+	return false
+}
+
+// Classify judges the nature of a single edit from the kinds of its nodes
+func Classify(e Edit) Category {
+	node := e.Src
+	if node == nil {
+		node = e.Dst
+	}
+	switch {
+	case e.Op == Relocate:
+		return Moved
+	case e.Op == Respell && canonical(e.Dst):
+		return LocalRename
+	case e.Op == Respell && isIdentifier(node):
+		return MappedRename
+	case e.Op == Respell:
+		return Spelling
+	case e.Op == Move:
+		return Reorder
+	case isComment(node):
+		return Comment
+	case isDocstring(node):
+		return Docstring
+	case e.Op != Update:
+		return Structural
+	case isLiteral(node):
+		return Literal
+	case isIdentifier(node):
+		return Rename
+	}
+	return Structural
+}
+
+// Documentation is true of an edit to comments or docstrings alone
+func Documentation(e Edit) bool {
+	category := Classify(e)
+	return category == Comment || category == Docstring
+}
+
+// ClassifyAll judges a group of edits by the most significant among them
+func ClassifyAll(edits []Edit) Category {
+	category := Layout
+	for _, edit := range edits {
+		if c := Classify(edit); c > category {
+			category = c
+		}
+	}
+	return category
+}
@@ -0,0 +1,86 @@
+package treediff_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// A function whose docstring and return value may be varied
+const pyFunction = `Module(
+   body=[
+      FunctionDef(
+         name='f',
+         body=[
+            Expr(
+               value=Constant(
+                  value=%s,
+                  lineno=2,
+                  col_offset=4,
+                  end_lineno=2,
+                  end_col_offset=9),
+               lineno=2,
+               col_offset=4,
+               end_lineno=2,
+               end_col_offset=9),
+            Return(
+               value=Constant(
+                  value=%s,
+                  lineno=3,
+                  col_offset=11,
+                  end_lineno=3,
+                  end_col_offset=12),
+               lineno=3,
+               col_offset=4,
+               end_lineno=3,
+               end_col_offset=12)],
+         lineno=1,
+         col_offset=0,
+         end_lineno=3,
+         end_col_offset=12)])`
+
+func pyTree(t *testing.T, doc string, value string) *treediff.Node {
+	return fixtureTree(t, types.Python, pyFunction, doc, value)
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		src      *treediff.Node
+		dst      *treediff.Node
+		category treediff.Category
+	}{
+		{assignments(t, "x=1", "y=2"), assignments(t, "x=1", "y=5"), treediff.Literal},
+		{assignments(t, "x=1", "y=2"), assignments(t, "x=1", "w=2"), treediff.Rename},
+		{assignments(t, "x=1", "y=2"), assignments(t, "y=2", "x=1"), treediff.Reorder},
+		{assignments(t, "x=1", "y=2"), assignments(t, "x=1", "w=4", "y=2"), treediff.Structural},
+		{pyTree(t, "'Doc'", "1"), pyTree(t, "'Docs'", "1"), treediff.Docstring},
+		{pyTree(t, "'Doc'", "1"), pyTree(t, "'Doc'", "2"), treediff.Literal},
+	}
+	for _, c := range cases {
+		edits := treediff.Diff(c.src, c.dst)
+		if category := treediff.ClassifyAll(edits); category != c.category {
+			t.Fatalf("Classified %s as %s rather than %s",
+				describe(edits), category, c.category)
+		}
+	}
+}
+
+func TestDocumentation(t *testing.T) {
+	cases := []struct {
+		src *treediff.Node
+		dst *treediff.Node
+		doc bool
+	}{
+		{pyTree(t, "'Doc'", "1"), pyTree(t, "'Docs'", "1"), true},
+		{pyTree(t, "'Doc'", "1"), pyTree(t, "'Doc'", "2"), false},
+		{pyTree(t, "'Doc'", "'one'"), pyTree(t, "'Doc'", "'two'"), false},
+	}
+	for _, c := range cases {
+		for _, edit := range treediff.Diff(c.src, c.dst) {
+			if treediff.Documentation(edit) != c.doc {
+				t.Fatalf("Judged %s as documentation: %t", edit, !c.doc)
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package treediff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of one operation of an edit script
+type Op int8
+
+const (
+	Insert   Op = iota // A subtree present only in the destination
+	Delete             // A subtree present only in the source
+	Update             // A matched node whose label changed
+	Move               // A matched subtree with a new parent or position
+	Relocate           // A declaration moved where its position is not significant
+	Respell            // A matched node whose label changed only as written
+)
+
+func (op Op) String() string {
+	switch op {
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	case Update:
+		return "update"
+	case Move:
+		return "move"
+	case Relocate:
+		return "relocate"
+	case Respell:
+		return "respell"
+	}
+	return "unknown"
+}
+
+// Edit is one operation transforming the source tree into the destination.
+// Src is nil for an insert, and Dst is nil for a delete.
+type Edit struct {
+	Op  Op
+	Src *Node
+	Dst *Node
+}
+
+func (e Edit) String() string {
+	switch e.Op {
+	case Insert:
+		return fmt.Sprintf("insert %s at line %d", e.Dst, e.Dst.Span.StartLine)
+	case Delete:
+		return fmt.Sprintf("delete %s at line %d", e.Src, e.Src.Span.StartLine)
+	case Update:
+		return fmt.Sprintf("update %s to %s at line %d",
+			e.Src, e.Dst, e.Dst.Span.StartLine)
+	case Respell:
+		return fmt.Sprintf("respell %s as %s at line %d",
+			e.Src.Written(), e.Dst.Written(), e.Dst.Span.StartLine)
+	}
+	return fmt.Sprintf("%s %s from line %d to line %d",
+		e.Op, e.Src, e.Src.Span.StartLine, e.Dst.Span.StartLine)
+}
+
+// Semantic is false of edits which do not change what a program means:
+// relocations of declarations, and respellings of labels
+func Semantic(e Edit) bool {
+	return e.Op != Relocate && e.Op != Respell
+}
+
+// Diff computes the edit script between two trees.  An empty script means
+// the trees are the same in everything but the positions of nodes.
+func Diff(src *Node, dst *Node) []Edit {
+	if src.hash == dst.hash {
+		return respellings(src, dst)
+	}
+	return EditScript(src, dst, Match(src, dst))
+}
+
+// respellings lists the nodes of identical trees whose labels, as written,
+// differ nonetheless
+func respellings(src *Node, dst *Node) []Edit {
+	var edits []Edit
+	if src.Written() != dst.Written() {
+		edits = append(edits, Edit{Op: Respell, Src: src, Dst: dst})
+	}
+	for i := range src.Children {
+		edits = append(edits, respellings(src.Children[i], dst.Children[i])...)
+	}
+	return edits
+}
+
+// EditScript derives the operations implied by a mapping between trees.
+// Only the roots of inserted, deleted, or moved subtrees are reported.
+func EditScript(src *Node, dst *Node, m *Mapping) []Edit {
+	var edits []Edit
+	for _, node := range src.PreOrder() {
+		if m.srcToDst[node] == nil && (node.Parent == nil || m.srcToDst[node.Parent] != nil) {
+			edits = append(edits, Edit{Op: Delete, Src: node})
+		}
+	}
+
+	moved := map[*Node]bool{}
+	for _, node := range dst.PreOrder() {
+		partner := m.dstToSrc[node]
+		if partner != nil && len(node.Children) > 0 {
+			for _, child := range reordered(m, partner, node) {
+				moved[child] = true
+			}
+		}
+	}
+	for _, node := range dst.PreOrder() {
+		partner := m.dstToSrc[node]
+		switch {
+		case partner == nil:
+			if node.Parent == nil || m.dstToSrc[node.Parent] != nil {
+				edits = append(edits, Edit{Op: Insert, Dst: node})
+			}
+			continue
+		case node.Parent != nil && m.srcToDst[partner.Parent] != node.Parent:
+			edits = append(edits, Edit{Op: Move, Src: partner, Dst: node})
+		case moved[node]:
+			edits = append(edits, Edit{Op: Move, Src: partner, Dst: node})
+		}
+		if partner.Label != node.Label {
+			edits = append(edits, Edit{Op: Update, Src: partner, Dst: node})
+		} else if partner.Written() != node.Written() {
+			edits = append(edits, Edit{Op: Respell, Src: partner, Dst: node})
+		}
+	}
+	return edits
+}
+
+// reordered finds the children of a destination node that stayed with
+// their parent, but fall outside the longest run keeping their order
+func reordered(m *Mapping, src *Node, dst *Node) []*Node {
+	var stayed []*Node
+	for _, child := range dst.Children {
+		if partner := m.dstToSrc[child]; partner != nil && partner.Parent == src {
+			stayed = append(stayed, child)
+		}
+	}
+	var before []*Node
+	for _, child := range src.Children {
+		if partner := m.srcToDst[child]; partner != nil && partner.Parent == dst {
+			before = append(before, partner)
+		}
+	}
+	identity := func(n *Node) string { return fmt.Sprintf("%p", n) }
+	kept := map[*Node]bool{}
+	for _, pair := range lcs(before, stayed, identity) {
+		kept[pair[1]] = true
+	}
+	var moves []*Node
+	for _, child := range stayed {
+		if !kept[child] {
+			moves = append(moves, child)
+		}
+	}
+	return moves
+}
+
+// relocatable is true of nodes whose position among their siblings is not
+// significant: named declarations, and Go's grouped declarations
+func relocatable(n *Node) bool {
+	_, ok := DeclarationOf(n)
+	return ok || n.Kind == "GenDecl"
+}
+
+// decorated is true of a Python definition with decorators, which often
+// register the definition somewhere, and so in order
+func decorated(n *Node) bool {
+	decorators := child(n, "decorator_list")
+	return decorators != nil && len(decorators.Children) > 0
+}
+
+// scopeOf names the declarations enclosing a node, excluding any it is
+func scopeOf(n *Node) string {
+	var names []string
+	for _, decl := range enclosing(n.Parent) {
+		names = append(names, decl.String())
+	}
+	return strings.Join(names, " < ")
+}
+
+// RelocateDeclarations marks the moves of declarations among the others of
+// their scope as relocations, which do not change what a program means.
+// Moves into another scope remain moves.  Decorated definitions are left
+// as moves when keepDecorated is true.
+func RelocateDeclarations(edits []Edit, keepDecorated bool) []Edit {
+	relocated := make([]Edit, len(edits))
+	for i, edit := range edits {
+		relocated[i] = edit
+		if edit.Op != Move || !relocatable(edit.Src) || !relocatable(edit.Dst) {
+			continue
+		}
+		if keepDecorated && (decorated(edit.Src) || decorated(edit.Dst)) {
+			continue
+		}
+		if edit.Src.Field == edit.Dst.Field && edit.Src.Parent != nil &&
+			edit.Dst.Parent != nil && edit.Src.Parent.Kind == edit.Dst.Parent.Kind &&
+			scopeOf(edit.Src) == scopeOf(edit.Dst) {
+			relocated[i].Op = Relocate
+		}
+	}
+	return relocated
+}
@@ -0,0 +1,87 @@
+package treediff
+
+import (
+	"strings"
+)
+
+// Bounds on the context an explanation gives of an edit: the most nodes
+// of a subtree shown whole, and the depth to which one is written out
+const (
+	contextSize  = 8
+	contextDepth = 5
+	renderWidth  = 120
+)
+
+// Render writes a subtree compactly in the manner of Python's ast.dump,
+// e.g. `Call(func=Name(id='print', ctx=Load), args=[...])`, with nodes
+// deeper than the given depth elided
+func Render(n *Node, depth int) string {
+	if n.Field == n.Kind && n.Label != "" {
+		return n.Written()
+	}
+	if depth <= 0 {
+		return "..."
+	}
+	var parts []string
+	for _, c := range n.Children {
+		part := Render(c, depth-1)
+		if c.Field != "" {
+			part = c.Field + "=" + part
+		}
+		parts = append(parts, part)
+	}
+	if n.Label != "" {
+		parts = append([]string{n.Written()}, parts...)
+	}
+	switch {
+	case n.Kind == "[]":
+		return "[" + strings.Join(parts, ", ") + "]"
+	case len(parts) == 0:
+		return n.Kind
+	}
+	return n.Kind + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// surrounding finds the smallest subtree around a changed node that reads as
+// something in the source: not an attribute, and grown to include its
+// parent while either is small, but not a list or a declaration.  A name
+// or a constant alone is so grown at least once, into its expression.
+func surrounding(n *Node) *Node {
+	n = owner(n)
+	for p := n.Parent; p != nil && p.Kind != "[]"; p = p.Parent {
+		if p.Size() > contextSize && n.Height() > 2 {
+			break
+		}
+		if _, ok := DeclarationOf(p); ok {
+			break
+		}
+		n = p
+	}
+	return n
+}
+
+// clip shortens a rendering to the width of a line
+func clip(text string) string {
+	if len(text) > renderWidth {
+		return text[:renderWidth-3] + "..."
+	}
+	return text
+}
+
+// Explain describes an edit by the pair of subtrees that differ, e.g.
+// `Call(func=Name(id='print')) -> Call(func=Name(id='log'))`, or the one
+// subtree inserted or deleted
+func Explain(e Edit) string {
+	switch {
+	case e.Src == nil:
+		return "+ " + clip(Render(surrounding(e.Dst), contextDepth))
+	case e.Dst == nil:
+		return "- " + clip(Render(surrounding(e.Src), contextDepth))
+	}
+	src := clip(Render(surrounding(e.Src), contextDepth))
+	dst := clip(Render(surrounding(e.Dst), contextDepth))
+	if e.Op == Move || e.Op == Relocate {
+		return src + " moved"
+	}
+	return src + " -> " + dst
+}
@@ -0,0 +1,32 @@
+package treediff_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+)
+
+func TestExplain(t *testing.T) {
+	src, dst := pyAddTree(t, "x", "x", "y"), pyAddTree(t, "x", "x", "z")
+	edits := treediff.Diff(src, dst)
+	if len(edits) != 1 {
+		t.Fatalf("Expected one edit, got %s", describe(edits))
+	}
+	// The renamed name is shown within its expression, but no further
+	explanation := treediff.Explain(edits[0])
+	expected := []string{"BinOp(left=Name(", "right=Name(id='y', ctx=Load))", "-> BinOp(", "id='z'"}
+	for _, part := range expected {
+		if !strings.Contains(explanation, part) {
+			t.Fatalf("Explanation lacks %q: %s", part, explanation)
+		}
+	}
+	if strings.Contains(explanation, "Return") {
+		t.Fatalf("Explanation shows more than the expression: %s", explanation)
+	}
+
+	// A subtree beyond the depth shown is elided
+	if rendered := treediff.Render(src, 2); rendered != "Module(body=[...])" {
+		t.Fatalf("Rendered as %s", rendered)
+	}
+}
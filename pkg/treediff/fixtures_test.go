@@ -0,0 +1,24 @@
+package treediff_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// fixtureTree parses a tree in the output format of one parser, the verbs
+// of the format filled in from the arguments
+func fixtureTree(
+	t *testing.T,
+	parse types.ParseType,
+	format string,
+	args ...interface{},
+) *treediff.Node {
+	root, err := treediff.Parse([]byte(fmt.Sprintf(format, args...)), parse, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse tree: %s", err)
+	}
+	return root
+}
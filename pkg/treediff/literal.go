@@ -0,0 +1,188 @@
+package treediff
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// NormalizeLiterals replaces the labels of literals as written with labels
+// given by their values, so that, e.g., 0x10 and 16, 1_000 and 1000, 'a'
+// and "a", or a raw and an interpreted string with the same content compare
+// equal.  The labels as written remain in Original, and Diff reports them
+// as respellings.  Python and Ruby trees already hold values, so only the
+// spelling of a Python string's prefix is disregarded.
+func NormalizeLiterals(root *Node, parseType types.ParseType) {
+	for _, n := range root.PreOrder() {
+		switch parseType {
+		case types.Python:
+			pyLiteral(n)
+		case types.Go:
+			goLiteral(n)
+		case types.JavaScript:
+			jsLiteral(n)
+		case types.Treesit:
+			treesitLiteral(n)
+		}
+	}
+	root.Finish()
+}
+
+// relabel gives a node the label of its value, keeping the label as written
+func relabel(n *Node, label string) {
+	if label == n.Label {
+		return
+	}
+	if n.Original == "" {
+		n.Original = n.Label
+	}
+	n.Label = label
+}
+
+// number gives the value of a numeric literal in decimal, or false if it
+// is not one.  Digits may be separated by underscores and prefixed by a
+// base, but a leading zero, octal in some languages and not in others, is
+// left as written.  Floating point values are exact, as a fraction when
+// not whole, and keep a decimal point, so 1.0 differs from 1.
+func number(literal string) (string, bool) {
+	digits := strings.ReplaceAll(literal, "_", "")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return "", false
+	}
+	if i, ok := new(big.Int).SetString(digits, 0); ok {
+		return i.String(), true
+	}
+	if strings.HasPrefix(strings.ToLower(digits), "0x") &&
+		!strings.ContainsAny(digits, "pP") {
+		return "", false
+	}
+	r, ok := new(big.Rat).SetString(digits)
+	if !ok {
+		return "", false
+	}
+	if r.IsInt() {
+		return r.RatString() + ".0", true
+	}
+	return r.RatString(), true
+}
+
+// text gives the content of a quoted string or character literal in the
+// manner of Go, C, and their kin, including a Rust raw string, or false if
+// its spelling is not understood
+func text(literal string) (string, bool) {
+	if strings.HasPrefix(literal, "r") {
+		raw := strings.Trim(literal[1:], "#")
+		if len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+			return raw[1 : len(raw)-1], true
+		}
+		return "", false
+	}
+	value, err := strconv.Unquote(literal)
+	return value, err == nil
+}
+
+//-- Python
+
+// The kind of a Constant records only a u prefix, which Python 3 ignores
+func pyLiteral(n *Node) {
+	if n.Kind != "Constant" {
+		return
+	}
+	var kept []*Node
+	for _, c := range n.Children {
+		if c.Field != "kind" {
+			kept = append(kept, c)
+		}
+	}
+	n.Children = kept
+}
+
+//-- Go
+
+// The Value of a BasicLit is its source quoted once more by gotree, and
+// its Kind says how to read it
+func goLiteral(n *Node) {
+	value, kind := child(n, "Value"), child(n, "Kind")
+	if n.Kind != "BasicLit" || value == nil || kind == nil {
+		return
+	}
+	source, err := strconv.Unquote(value.Label)
+	if err != nil {
+		return
+	}
+	switch kind.Label {
+	case "INT", "FLOAT":
+		if v, ok := number(source); ok {
+			relabel(value, strconv.Quote(v))
+		}
+	case "IMAG":
+		if v, ok := number(strings.TrimSuffix(source, "i")); ok {
+			relabel(value, strconv.Quote(v+"i"))
+		}
+	case "CHAR", "STRING":
+		if v, ok := text(source); ok {
+			relabel(value, strconv.Quote(strconv.Quote(v)))
+		}
+	}
+}
+
+//-- JavaScript
+
+// acorn gives the value of a Literal beside its raw spelling, and the
+// cooked value of a TemplateElement beside its raw one
+func jsLiteral(n *Node) {
+	switch n.Kind {
+	case "Literal":
+		raw, value := child(n, "raw"), child(n, "value")
+		// A regular expression or a big integer has no value of its own
+		if raw == nil || value == nil || value.Kind != value.Field || value.Label == "null" {
+			return
+		}
+		// A number and a string of its digits have the same value label
+		if strings.HasPrefix(raw.Label, `"`) || strings.HasPrefix(raw.Label, "'") {
+			relabel(raw, strconv.Quote(value.Label))
+		} else {
+			relabel(raw, value.Label)
+		}
+	case "TemplateElement":
+		parts := child(n, "value")
+		if parts == nil {
+			return
+		}
+		raw, cooked := child(parts, "raw"), child(parts, "cooked")
+		if raw != nil && cooked != nil && cooked.Label != "null" {
+			relabel(raw, cooked.Label)
+		}
+	}
+}
+
+//-- Tree-sitter
+
+// treesit labels only those literals whose kinds end in "_literal", with
+// their source.  Kinds of strings differing only in their quoting, e.g.
+// "raw_string_literal" and "interpreted_string_literal", become one, and
+// nodes within a string, such as its escape sequences, are dropped.
+func treesitLiteral(n *Node) {
+	if !strings.HasSuffix(n.Kind, "_literal") || n.Label == "" {
+		return
+	}
+	switch {
+	case strings.HasSuffix(n.Kind, "string_literal"):
+		if v, ok := text(n.Label); ok {
+			n.Kind = "string_literal"
+			n.Children = nil
+			relabel(n, strconv.Quote(v))
+		}
+	case strings.HasSuffix(n.Kind, "char_literal"), n.Kind == "rune_literal":
+		if v, ok := text(n.Label); ok {
+			n.Children = nil
+			relabel(n, strconv.Quote(v))
+		}
+	default:
+		if v, ok := number(n.Label); ok {
+			relabel(n, v)
+		}
+	}
+}
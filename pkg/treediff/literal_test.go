@@ -0,0 +1,149 @@
+package treediff_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// A tree-sitter style tree of the Go statement `x = literal`
+const tsAssign = `SrcLn | Node
+00001 | (source_file
+00001 |   (expression_statement
+00001 |     (assignment_statement
+00001 |       left: (expression_list
+00001 |         (identifier x))
+00001 |       right: (expression_list
+00001 |         (%s %s)))))`
+
+func literalTree(t *testing.T, kind string, literal string) *treediff.Node {
+	root := fixtureTree(t, types.Treesit, tsAssign, kind, literal)
+	treediff.NormalizeLiterals(root, types.Treesit)
+	return root
+}
+
+func TestNormalizeLiterals(t *testing.T) {
+	cases := []struct {
+		src      *treediff.Node
+		dst      *treediff.Node
+		category treediff.Category
+	}{
+		{literalTree(t, "int_literal", "0x10"), literalTree(t, "int_literal", "16"),
+			treediff.Spelling},
+		{literalTree(t, "int_literal", "1_000"), literalTree(t, "int_literal", "1000"),
+			treediff.Spelling},
+		{literalTree(t, "float_literal", "1e3"), literalTree(t, "float_literal", "1000.0"),
+			treediff.Spelling},
+		{literalTree(t, "raw_string_literal", "`é`"),
+			literalTree(t, "interpreted_string_literal", `"é"`),
+			treediff.Spelling},
+		{literalTree(t, "rune_literal", "'a'"), literalTree(t, "rune_literal", `'\x61'`),
+			treediff.Spelling},
+		{literalTree(t, "int_literal", "0x10"), literalTree(t, "int_literal", "17"),
+			treediff.Literal},
+		// A leading zero is octal in some languages and not in others
+		{literalTree(t, "int_literal", "017"), literalTree(t, "int_literal", "15"),
+			treediff.Literal},
+		// The type of a number matters, even if its value does not
+		{literalTree(t, "number_literal", "1"), literalTree(t, "number_literal", "1.0"),
+			treediff.Literal},
+	}
+	for _, c := range cases {
+		edits := treediff.Diff(c.src, c.dst)
+		if category := treediff.ClassifyAll(edits); category != c.category {
+			t.Fatalf("Classified %s as %s rather than %s",
+				describe(edits), category, c.category)
+		}
+		for _, edit := range edits {
+			if c.category == treediff.Spelling && treediff.Semantic(edit) {
+				t.Fatalf("Respelling %s is semantic", edit)
+			}
+		}
+	}
+}
+
+// The gotree output for `var x = literal`, the Value of the literal quoted
+const goLiteral = `SrcLn | Node
+00000 | *ast.File
+00000 |   Doc: nil
+00001 |   Package: 1:1
+00001 |   Name: *ast.Ident
+00001 |     NamePos: 1:9
+00001 |     Name: "p"
+00001 |     Obj: nil
+00001 |   Decls: []ast.Decl (len = 1)
+00001 |     0: *ast.GenDecl
+00001 |       Doc: nil
+00003 |       TokPos: 3:1
+00003 |       Tok: var
+00003 |       Specs: []ast.Spec (len = 1)
+00003 |         0: *ast.ValueSpec
+00003 |           Doc: nil
+00003 |           Names: []*ast.Ident (len = 1)
+00003 |             0: *ast.Ident
+00003 |               NamePos: 3:5
+00003 |               Name: "x"
+00003 |               Obj: nil
+00003 |           Type: nil
+00003 |           Values: []ast.Expr (len = 1)
+00003 |             0: *ast.BasicLit
+00003 |               ValuePos: 3:9
+00003 |               ValueEnd: 3:13
+00003 |               Kind: %s
+00003 |               Value: %s
+00003 |           Comment: nil
+00001 |   FileStart: 1:1
+00003 |   FileEnd: 3:14
+`
+
+func goLiteralTree(t *testing.T, kind string, value string) *treediff.Node {
+	root := fixtureTree(t, types.Go, goLiteral, kind, value)
+	treediff.NormalizeLiterals(root, types.Go)
+	return root
+}
+
+func TestNormalizeGo(t *testing.T) {
+	cases := []struct {
+		src      *treediff.Node
+		dst      *treediff.Node
+		category treediff.Category
+	}{
+		{goLiteralTree(t, "INT", `"0x10"`), goLiteralTree(t, "INT", `"16"`),
+			treediff.Spelling},
+		{goLiteralTree(t, "FLOAT", `"1e3"`), goLiteralTree(t, "FLOAT", `"1000.0"`),
+			treediff.Spelling},
+		// An escaped tab, and a tab within a raw string
+		{goLiteralTree(t, "STRING", `"\"a\\tb\""`),
+			goLiteralTree(t, "STRING", "\"`a\\tb`\""),
+			treediff.Spelling},
+		{goLiteralTree(t, "INT", `"0x10"`), goLiteralTree(t, "INT", `"17"`),
+			treediff.Literal},
+		{goLiteralTree(t, "INT", `"1"`), goLiteralTree(t, "FLOAT", `"1.0"`),
+			treediff.Literal},
+	}
+	for _, c := range cases {
+		edits := treediff.Diff(c.src, c.dst)
+		if category := treediff.ClassifyAll(edits); category != c.category {
+			t.Fatalf("Classified %s as %s rather than %s",
+				describe(edits), category, c.category)
+		}
+	}
+}
+
+func TestNormalizeJavaScript(t *testing.T) {
+	literal := func(raw string, value string) *treediff.Node {
+		root := fixtureTree(t, types.JavaScript,
+			`{"type": "Literal", "raw": %q, "value": %s}`, raw, value)
+		treediff.NormalizeLiterals(root, types.JavaScript)
+		return root
+	}
+	edits := treediff.Diff(literal(`'a'`, `"a"`), literal(`"a"`, `"a"`))
+	if treediff.ClassifyAll(edits) != treediff.Spelling {
+		t.Fatalf("Quotes of a string are not a respelling: %s", describe(edits))
+	}
+	edits = treediff.Diff(literal(`16`, `16`), literal(`"16"`, `"16"`))
+	if treediff.ClassifyAll(edits) == treediff.Spelling {
+		t.Fatalf("A number and a string are a respelling: %s", describe(edits))
+	}
+}
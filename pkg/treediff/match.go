@@ -0,0 +1,298 @@
+package treediff
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Subtrees shorter than this are left to the bottom-up phase, since small
+// subtrees such as `ctx=Load()` recur everywhere and match ambiguously
+const minHeight = 2
+
+// Containers sharing fewer than this fraction of their matched descendants
+// are not considered the same node
+const minDice = 0.5
+
+// Mapping pairs the nodes of a source tree with those of a destination
+type Mapping struct {
+	srcToDst map[*Node]*Node
+	dstToSrc map[*Node]*Node
+}
+
+func newMapping() *Mapping {
+	return &Mapping{srcToDst: map[*Node]*Node{}, dstToSrc: map[*Node]*Node{}}
+}
+
+// Dst returns the node matched to a source node, or nil
+func (m *Mapping) Dst(src *Node) *Node {
+	return m.srcToDst[src]
+}
+
+// Src returns the node matched to a destination node, or nil
+func (m *Mapping) Src(dst *Node) *Node {
+	return m.dstToSrc[dst]
+}
+
+func (m *Mapping) add(src *Node, dst *Node) {
+	m.srcToDst[src] = dst
+	m.dstToSrc[dst] = src
+}
+
+// addIsomorphic pairs every node of two subtrees having the same hash
+func (m *Mapping) addIsomorphic(src *Node, dst *Node) {
+	m.add(src, dst)
+	for i := range src.Children {
+		m.addIsomorphic(src.Children[i], dst.Children[i])
+	}
+}
+
+// Match pairs the nodes of two trees, first those at the roots of the
+// largest identical subtrees, then declarations of the same name, then
+// containers sharing enough of their matched descendants, recovering
+// unmatched children of each pair found
+func Match(src *Node, dst *Node) *Mapping {
+	m := newMapping()
+	matchTopDown(m, src, dst)
+	matchDeclarations(m, src, dst)
+	matchBottomUp(m, src, dst)
+	return m
+}
+
+func matchTopDown(m *Mapping, src *Node, dst *Node) {
+	srcNodes := src.PreOrder()
+	candidates := map[uint64][]*Node{}
+	for _, node := range srcNodes {
+		if node.height >= minHeight {
+			candidates[node.hash] = append(candidates[node.hash], node)
+		}
+	}
+	srcIndex := indexOf(srcNodes)
+	dstNodes := dst.PreOrder()
+	dstIndex := indexOf(dstNodes)
+
+	// Taller subtrees first, so that nested subtrees are claimed with them
+	byHeight := append([]*Node{}, dstNodes...)
+	sort.SliceStable(byHeight, func(i, j int) bool {
+		return byHeight[i].height > byHeight[j].height
+	})
+	for _, node := range byHeight {
+		if node.height < minHeight || m.dstToSrc[node] != nil {
+			continue
+		}
+		var best *Node
+		bestScore := -1.0
+		for _, cand := range candidates[node.hash] {
+			if m.srcToDst[cand] != nil {
+				continue
+			}
+			score := parentSimilarity(m, cand, node)
+			// Prefer the candidate at a similar relative place in the file
+			score -= abs(float64(srcIndex[cand])/float64(len(srcNodes)) -
+				float64(dstIndex[node])/float64(len(dstNodes)))
+			if score > bestScore {
+				best, bestScore = cand, score
+			}
+		}
+		if best != nil {
+			m.addIsomorphic(best, node)
+		}
+	}
+}
+
+// unmatchedDeclarations lists the unmatched declarations of a tree by their
+// qualified names, in pre-order.  Names declared more than once are
+// ambiguous, so are omitted.
+func unmatchedDeclarations(root *Node, matched map[*Node]*Node) ([]string, map[string]*Node) {
+	var names []string
+	byName := map[string]*Node{}
+	count := map[string]int{}
+	for _, node := range root.PreOrder() {
+		decl, ok := DeclarationOf(node)
+		if !ok || matched[node] != nil {
+			continue
+		}
+		name := node.Kind + " " + decl.String() + " < " + scopeOf(node)
+		count[name]++
+		if count[name] == 1 {
+			names = append(names, name)
+		}
+		byName[name] = node
+	}
+	var unique []string
+	for _, name := range names {
+		if count[name] == 1 {
+			unique = append(unique, name)
+		}
+	}
+	return unique, byName
+}
+
+// matchDeclarations pairs unmatched declarations of the same name in the
+// same scope, so that one both moved and changed is still matched whole
+func matchDeclarations(m *Mapping, src *Node, dst *Node) {
+	names, srcDecls := unmatchedDeclarations(src, m.srcToDst)
+	dstNames, dstDecls := unmatchedDeclarations(dst, m.dstToSrc)
+	unique := map[string]bool{}
+	for _, name := range dstNames {
+		unique[name] = true
+	}
+	for _, name := range names {
+		s, d := srcDecls[name], dstDecls[name]
+		if !unique[name] || m.srcToDst[s] != nil || m.dstToSrc[d] != nil {
+			continue
+		}
+		m.add(s, d)
+		recoverChildren(m, s, d)
+	}
+}
+
+// parentSimilarity favours candidates whose context resembles the node's
+func parentSimilarity(m *Mapping, src *Node, dst *Node) float64 {
+	if src.Parent == nil || dst.Parent == nil {
+		return 0
+	}
+	switch {
+	case m.srcToDst[src.Parent] == dst.Parent:
+		return 3
+	case src.Parent.hash == dst.Parent.hash:
+		return 2
+	case src.Parent.Kind == dst.Parent.Kind && src.Field == dst.Field:
+		return 1
+	}
+	return 0
+}
+
+func matchBottomUp(m *Mapping, src *Node, dst *Node) {
+	for _, node := range src.PostOrder() {
+		if m.srcToDst[node] != nil || len(node.Children) == 0 {
+			continue
+		}
+		if node == src {
+			if dst.Kind == src.Kind && m.dstToSrc[dst] == nil {
+				m.add(src, dst)
+				recoverChildren(m, src, dst)
+			}
+			continue
+		}
+
+		// Count the matched descendants of the node falling beneath each
+		// unmatched destination container of the same kind
+		common := map[*Node]int{}
+		for _, desc := range node.PreOrder()[1:] {
+			partner := m.srcToDst[desc]
+			if partner == nil {
+				continue
+			}
+			for anc := partner.Parent; anc != nil; anc = anc.Parent {
+				if m.dstToSrc[anc] == nil && anc.Kind == node.Kind {
+					common[anc]++
+				}
+			}
+		}
+		var best *Node
+		bestDice := 0.0
+		for cand, count := range common {
+			dice := 2 * float64(count) / float64(node.size-1+cand.size-1)
+			if dice > bestDice || (dice == bestDice && best != nil &&
+				cand.Span.StartLine < best.Span.StartLine) {
+				best, bestDice = cand, dice
+			}
+		}
+		if best != nil && bestDice >= minDice {
+			m.add(node, best)
+			recoverChildren(m, node, best)
+		}
+	}
+}
+
+// recoverChildren pairs the unmatched children of two matched nodes: first
+// those that are identical, then those alike but for their labels, and then
+// those of the same kind, keeping to the order in which they appear
+func recoverChildren(m *Mapping, src *Node, dst *Node) {
+	keys := []func(*Node) string{
+		func(n *Node) string { return fmt.Sprintf("%x", n.hash) },
+		func(n *Node) string { return n.Kind + "\x00" + n.Field + "\x00" + n.Label },
+		func(n *Node) string { return n.Kind + "\x00" + n.Field },
+	}
+	for _, key := range keys {
+		var srcFree, dstFree []*Node
+		for _, child := range src.Children {
+			if m.srcToDst[child] == nil {
+				srcFree = append(srcFree, child)
+			}
+		}
+		for _, child := range dst.Children {
+			if m.dstToSrc[child] == nil {
+				dstFree = append(dstFree, child)
+			}
+		}
+		for _, pair := range lcs(srcFree, dstFree, key) {
+			if pair[0].hash == pair[1].hash {
+				m.addIsomorphic(pair[0], pair[1])
+			} else {
+				m.add(pair[0], pair[1])
+				recoverChildren(m, pair[0], pair[1])
+			}
+		}
+	}
+}
+
+// lcs finds the longest common subsequence of two lists of nodes, where
+// nodes correspond if they have the same key
+func lcs(a []*Node, b []*Node, key func(*Node) string) [][2]*Node {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	ka := make([]string, len(a))
+	kb := make([]string, len(b))
+	for i, n := range a {
+		ka[i] = key(n)
+	}
+	for j, n := range b {
+		kb[j] = key(n)
+	}
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if ka[i] == kb[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	var pairs [][2]*Node
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case ka[i] == kb[j]:
+			pairs = append(pairs, [2]*Node{a[i], b[j]})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+func indexOf(nodes []*Node) map[*Node]int {
+	index := make(map[*Node]int, len(nodes))
+	for i, node := range nodes {
+		index[node] = i
+	}
+	return index
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
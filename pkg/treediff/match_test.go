@@ -0,0 +1,80 @@
+package treediff_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// assignments renders a tree-sitter style tree of one assignment per line
+func assignments(t *testing.T, stmts ...string) *treediff.Node {
+	var tree strings.Builder
+	tree.WriteString("SrcLn | Node\n00001 | (module\n")
+	for i, stmt := range stmts {
+		parts := strings.Split(stmt, "=")
+		fmt.Fprintf(&tree, "%05d |   (assignment\n", i+1)
+		fmt.Fprintf(&tree, "%05d |     left: (identifier %s)\n", i+1, parts[0])
+		fmt.Fprintf(&tree, "%05d |     right: (call\n", i+1)
+		fmt.Fprintf(&tree, "%05d |       function: (identifier f)\n", i+1)
+		fmt.Fprintf(&tree, "%05d |       arguments: (integer %s)))\n", i+1, parts[1])
+	}
+	return fixtureTree(t, types.Treesit, "%s", tree.String())
+}
+
+func describe(edits []treediff.Edit) string {
+	var descs []string
+	for _, edit := range edits {
+		descs = append(descs, edit.String())
+	}
+	return strings.Join(descs, "; ")
+}
+
+func TestDiffSame(t *testing.T) {
+	src := assignments(t, "x=1", "y=2")
+	dst := assignments(t, "x=1", "y=2")
+	if edits := treediff.Diff(src, dst); len(edits) != 0 {
+		t.Fatalf("Identical trees differ: %s", describe(edits))
+	}
+}
+
+func TestDiffUpdate(t *testing.T) {
+	src := assignments(t, "x=1", "y=2", "z=3")
+	dst := assignments(t, "x=1", "y=5", "z=3")
+	edits := treediff.Diff(src, dst)
+	if len(edits) != 1 || edits[0].Op != treediff.Update {
+		t.Fatalf("Expected one update, got: %s", describe(edits))
+	}
+	if edits[0].Src.Label != "2" || edits[0].Dst.Span.StartLine != 2 {
+		t.Fatalf("Wrong update: %s", describe(edits))
+	}
+}
+
+func TestDiffMove(t *testing.T) {
+	src := assignments(t, "x=1", "y=2", "z=3")
+	dst := assignments(t, "z=3", "x=1", "y=2")
+	edits := treediff.Diff(src, dst)
+	if len(edits) != 1 || edits[0].Op != treediff.Move {
+		t.Fatalf("Expected one move, got: %s", describe(edits))
+	}
+	if edits[0].Src.Span.StartLine != 3 || edits[0].Dst.Span.StartLine != 1 {
+		t.Fatalf("Wrong move: %s", describe(edits))
+	}
+}
+
+func TestDiffInsertDelete(t *testing.T) {
+	src := assignments(t, "x=1", "y=2")
+	dst := assignments(t, "x=1", "w=4", "y=2")
+	edits := treediff.Diff(src, dst)
+	if len(edits) != 1 || edits[0].Op != treediff.Insert ||
+		edits[0].Dst.Span.StartLine != 2 {
+		t.Fatalf("Expected one insert, got: %s", describe(edits))
+	}
+	edits = treediff.Diff(dst, src)
+	if len(edits) != 1 || edits[0].Op != treediff.Delete ||
+		edits[0].Src.Kind != "assignment" {
+		t.Fatalf("Expected one delete, got: %s", describe(edits))
+	}
+}
@@ -0,0 +1,133 @@
+package treediff
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// FileMove is a declaration that left one file and arrived in another, as
+// when a module is split or several are merged
+type FileMove struct {
+	Declaration // As declared in the file it moved to
+	From        string
+	To          string
+	Modified    bool
+}
+
+func (m FileMove) String() string {
+	change := "unchanged"
+	if m.Modified {
+		change = "and modified"
+	}
+	return fmt.Sprintf("%s moved from %s to %s %s", m.Declaration, m.From, m.To, change)
+}
+
+// Fingerprint identifies a declaration by its content alone.  Unlike Hash,
+// it disregards the field the declaration fills, which may differ between
+// files, e.g. a Python module's "body" and a Go file's "Decls".
+func Fingerprint(n *Node) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(n.Kind + "\x00" + n.Label + "\x00"))
+	for _, child := range n.Children {
+		fmt.Fprintf(h, "%x,", child.hash)
+	}
+	return h.Sum64()
+}
+
+// located is a declaration together with the file it is found in
+type located struct {
+	decl Declaration
+	path string
+}
+
+// qualified names a declaration within its scope, as matchDeclarations does
+func qualified(n *Node, decl Declaration) string {
+	return n.Kind + " " + decl.String() + " < " + scopeOf(n)
+}
+
+// departed lists the declarations of a tree that the other tree of the same
+// file lacks.  Once a declaration has departed, those within it are not
+// listed separately.
+func departed(n *Node, path string, others map[string]bool) []located {
+	if decl, ok := DeclarationOf(n); ok && !others[qualified(n, decl)] {
+		return []located{{decl: decl, path: path}}
+	}
+	var found []located
+	for _, c := range n.Children {
+		found = append(found, departed(c, path, others)...)
+	}
+	return found
+}
+
+// departures lists the declarations of each file in the trees that are
+// missing from the same file in the other trees, ordered by file
+func departures(trees map[string]*Node, others map[string]*Node) []located {
+	var paths []string
+	for path := range trees {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var found []located
+	for _, path := range paths {
+		names := map[string]bool{}
+		if other := others[path]; other != nil {
+			for _, n := range other.PreOrder() {
+				if decl, ok := DeclarationOf(n); ok {
+					names[qualified(n, decl)] = true
+				}
+			}
+		}
+		if trees[path] != nil {
+			found = append(found, departed(trees[path], path, names)...)
+		}
+	}
+	return found
+}
+
+// CrossFileMoves finds the declarations removed from one file and added to
+// another, given the trees of each changed file before and after the change.
+// A file absent before or after has no tree on that side.  Declarations are
+// paired first by fingerprint, so moved unchanged, then by kind and name,
+// so moved and modified; a key shared by several declarations is ambiguous
+// and pairs none of them.
+func CrossFileMoves(before map[string]*Node, after map[string]*Node) []FileMove {
+	gone := departures(before, after)
+	arrived := departures(after, before)
+	paired := map[*Node]bool{}
+	var moves []FileMove
+
+	pair := func(key func(located) string, modified bool) {
+		gones, arrivals := map[string]int{}, map[string]int{}
+		into := map[string]located{}
+		for _, a := range arrived {
+			if !paired[a.decl.Node] {
+				arrivals[key(a)]++
+				into[key(a)] = a
+			}
+		}
+		for _, g := range gone {
+			if !paired[g.decl.Node] {
+				gones[key(g)]++
+			}
+		}
+		for _, g := range gone {
+			k := key(g)
+			a := into[k]
+			if gones[k] != 1 || arrivals[k] != 1 || paired[g.decl.Node] ||
+				a.path == g.path {
+				continue
+			}
+			paired[g.decl.Node], paired[a.decl.Node] = true, true
+			moves = append(moves, FileMove{
+				Declaration: a.decl, From: g.path, To: a.path, Modified: modified})
+		}
+	}
+	pair(func(l located) string {
+		return fmt.Sprintf("%x", Fingerprint(l.decl.Node))
+	}, false)
+	pair(func(l located) string {
+		return l.decl.Node.Kind + " " + l.decl.String()
+	}, true)
+	return moves
+}
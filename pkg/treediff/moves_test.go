@@ -0,0 +1,41 @@
+package treediff_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+)
+
+func TestCrossFileMoves(t *testing.T) {
+	before := map[string]*treediff.Node{
+		"utils.c":   functionTree(t, "upper=1", "lower=2", "read=3"),
+		"strings.c": nil,
+		"files.c":   functionTree(t, "open=4"),
+	}
+	after := map[string]*treediff.Node{
+		"utils.c":   functionTree(t, "lower=2"),
+		"strings.c": functionTree(t, "upper=1"),
+		"files.c":   functionTree(t, "open=4", "read=5"),
+	}
+	moves := treediff.CrossFileMoves(before, after)
+	expect := []string{
+		"function upper moved from utils.c to strings.c unchanged",
+		"function read moved from utils.c to files.c and modified",
+	}
+	if len(moves) != len(expect) {
+		t.Fatalf("Expected %d moves, got %v", len(expect), moves)
+	}
+	for i, move := range moves {
+		if move.String() != expect[i] {
+			t.Fatalf("Move described as %q rather than %q", move, expect[i])
+		}
+	}
+
+	// A function removed from one file and declared anew in two is ambiguous
+	after["strings.c"] = functionTree(t, "upper=1", "read=6")
+	for _, move := range treediff.CrossFileMoves(before, after) {
+		if move.Name == "read" {
+			t.Fatalf("Ambiguous move reported: %s", move)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+/* Package treediff holds a common in-memory model of the parse trees that
+ * the various external tools produce, and a structural comparison of two
+ * such trees.  Rather than diffing the text of trees character by
+ * character, nodes are matched in the manner of GumTree (Falleri et al.,
+ * 2014) and the differences reported as insert, delete, update, and move
+ * operations on nodes whose source positions are known.
+ */
+package treediff
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+)
+
+// Span locates a node in its source file.  Lines are 1-based and columns
+// 0-based; a StartLine of zero means the position is unknown.
+type Span struct {
+	StartLine int `json:"start_line"`
+	StartCol  int `json:"start_col"`
+	EndLine   int `json:"end_line"`
+	EndCol    int `json:"end_col"`
+}
+
+// Node is one node of a parse tree.  Kind is the node type reported by the
+// parser (e.g. "FunctionDef", "*ast.CallExpr" as "CallExpr", "identifier"),
+// Field is the role of the node within its parent (e.g. "body", "test"),
+// and Label is the literal value, identifier, or operator it carries.
+// Where a normalization replaced the label, Original keeps it as written.
+type Node struct {
+	Kind     string
+	Field    string
+	Label    string
+	Original string
+	Span     Span
+	Children []*Node
+	Parent   *Node
+
+	hash   uint64
+	height int
+	size   int
+}
+
+func (n *Node) String() string {
+	desc := n.Kind
+	if n.Field != "" && n.Field != n.Kind {
+		desc = n.Field + "=" + desc
+	}
+	if n.Label != "" {
+		desc += fmt.Sprintf("(%s)", n.Label)
+	}
+	return desc
+}
+
+// MarshalJSON writes a subtree without the links to parents, and without
+// the attributes a node lacks
+func (n *Node) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Kind     string  `json:"kind"`
+		Field    string  `json:"field,omitempty"`
+		Label    string  `json:"label,omitempty"`
+		Original string  `json:"original,omitempty"`
+		Span     Span    `json:"span"`
+		Children []*Node `json:"children,omitempty"`
+	}{n.Kind, n.Field, n.Label, n.Original, n.Span, n.Children})
+}
+
+// Written is the label as it appears in the source
+func (n *Node) Written() string {
+	if n.Original != "" {
+		return n.Original
+	}
+	return n.Label
+}
+
+// Hash identifies the node and everything beneath it, disregarding spans
+func (n *Node) Hash() uint64 {
+	return n.hash
+}
+
+// Height is one for a leaf, otherwise one more than its tallest child
+func (n *Node) Height() int {
+	return n.height
+}
+
+// Size counts the node and all of its descendants
+func (n *Node) Size() int {
+	return n.size
+}
+
+// PreOrder lists the node and its descendants, parents before children
+func (n *Node) PreOrder() []*Node {
+	nodes := []*Node{n}
+	for _, child := range n.Children {
+		nodes = append(nodes, child.PreOrder()...)
+	}
+	return nodes
+}
+
+// PostOrder lists the node and its descendants, children before parents
+func (n *Node) PostOrder() []*Node {
+	var nodes []*Node
+	for _, child := range n.Children {
+		nodes = append(nodes, child.PostOrder()...)
+	}
+	return append(nodes, n)
+}
+
+// IsAncestorOf reports whether other lies strictly beneath the node
+func (n *Node) IsAncestorOf(other *Node) bool {
+	for p := other.Parent; p != nil; p = p.Parent {
+		if p == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Lines lists the source lines the node spans, if its position is known
+func (n *Node) Lines() []int {
+	var lines []int
+	if n.Span.StartLine == 0 {
+		return lines
+	}
+	for line := n.Span.StartLine; line <= n.Span.EndLine; line++ {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Finish links parents, computes hashes, heights, and sizes, and widens
+// each span to cover those of its children.  Nodes whose position the
+// parser did not report take that of their parent.  Parsers call this once
+// a tree is built; so must anything that later modifies a tree.
+func (n *Node) Finish() {
+	n.finish()
+	n.inherit()
+}
+
+func (n *Node) finish() {
+	for _, child := range n.Children {
+		child.Parent = n
+		child.finish()
+	}
+	n.summarize()
+}
+
+// summarize computes the hash, height, size, and span of a node from those
+// of its children
+func (n *Node) summarize() {
+	n.height = 1
+	n.size = 1
+	h := fnv.New64a()
+	h.Write([]byte(n.Kind + "\x00" + n.Field + "\x00" + n.Label + "\x00"))
+	for _, child := range n.Children {
+		if child.height+1 > n.height {
+			n.height = child.height + 1
+		}
+		n.size += child.size
+		fmt.Fprintf(h, "%x,", child.hash)
+		n.Span = widen(n.Span, child.Span)
+	}
+	n.hash = h.Sum64()
+}
+
+func (n *Node) inherit() {
+	for _, child := range n.Children {
+		if child.Span.StartLine == 0 {
+			child.Span = n.Span
+		}
+		child.inherit()
+	}
+}
+
+// widen returns the smallest span covering both spans
+func widen(span Span, other Span) Span {
+	if other.StartLine == 0 {
+		return span
+	}
+	if span.StartLine == 0 {
+		return other
+	}
+	if other.StartLine < span.StartLine ||
+		(other.StartLine == span.StartLine && other.StartCol < span.StartCol) {
+		span.StartLine, span.StartCol = other.StartLine, other.StartCol
+	}
+	if other.EndLine > span.EndLine ||
+		(other.EndLine == span.EndLine && other.EndCol > span.EndCol) {
+		span.EndLine, span.EndCol = other.EndLine, other.EndCol
+	}
+	return span
+}
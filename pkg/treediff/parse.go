@@ -0,0 +1,420 @@
+package treediff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// Position converts an offset into the parsed source to a line and column,
+// for those parsers reporting offsets rather than lines
+type Position func(offset int) (line int, col int)
+
+// Parse builds the tree model from the raw output of one of the parsers.
+// The position function is needed only for parsers reporting offsets.
+func Parse(raw []byte, parseType types.ParseType, position Position) (*Node, error) {
+	var root *Node
+	var err error
+	switch parseType {
+	case types.Python:
+		root, err = parsePython(string(raw))
+	case types.Ruby:
+		root, err = parseRuby(string(raw))
+	case types.Go:
+		root, err = parsePrefixed(string(raw), goLine)
+	case types.Treesit:
+		root, err = parsePrefixed(string(raw), treesitLine)
+	case types.JavaScript:
+		root, err = parseESTree(raw, position)
+	default:
+		return nil, fmt.Errorf("No tree model for parse type %d", parseType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	root.Finish()
+	return root, nil
+}
+
+// Supported reports whether Parse understands a parse type
+func Supported(parseType types.ParseType) bool {
+	switch parseType {
+	case types.Python, types.Ruby, types.Go, types.Treesit, types.JavaScript:
+		return true
+	}
+	return false
+}
+
+// indented is one line of an indented tree text, already interpreted
+type indented struct {
+	depth int
+	node  *Node
+}
+
+// nest assembles nodes from lines of an indented tree, where each line is
+// the child of the nearest preceding line of lesser depth
+func nest(lines []indented) (*Node, error) {
+	if len(lines) == 0 {
+		return nil, errors.New("Empty parse tree")
+	}
+	root := &Node{Kind: "root"}
+	stack := []indented{{depth: -1, node: root}}
+	for _, line := range lines {
+		for stack[len(stack)-1].depth >= line.depth {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1].node
+		parent.Children = append(parent.Children, line.node)
+		stack = append(stack, line)
+	}
+	if len(root.Children) == 1 {
+		root = root.Children[0]
+	}
+	return root, nil
+}
+
+//-- Python: `python -m ast -a`
+
+var (
+	rePyCtor     = regexp.MustCompile(`^(?:(\w+)=)?(\w+)\($`)
+	rePyLeafCtor = regexp.MustCompile(`^(?:(\w+)=)?(\w+)\((.*)\)$`)
+	rePyList     = regexp.MustCompile(`^(?:(\w+)=)?\[$`)
+	rePyAttr     = regexp.MustCompile(`^(\w+)=(.*)$`)
+)
+
+func parsePython(raw string) (*Node, error) {
+	var lines []indented
+	var stack []indented
+	for _, text := range strings.Split(raw, "\n") {
+		content := strings.TrimSpace(text)
+		if content == "" {
+			continue
+		}
+		depth := len(text) - len(strings.TrimLeft(text, " "))
+		// Closing brackets trail the last child of the nodes they close
+		content = strings.TrimSuffix(balanced(content), ",")
+
+		for len(stack) > 0 && stack[len(stack)-1].depth >= depth {
+			stack = stack[:len(stack)-1]
+		}
+		node := &Node{}
+		if m := rePyCtor.FindStringSubmatch(content); m != nil {
+			node.Field, node.Kind = m[1], m[2]
+		} else if m := rePyList.FindStringSubmatch(content); m != nil {
+			node.Field, node.Kind = m[1], "[]"
+		} else if m := rePyLeafCtor.FindStringSubmatch(content); m != nil {
+			// Nodes without attributes, such as `ctx=Load()`, fit one line
+			node.Field, node.Kind, node.Label = m[1], m[2], m[3]
+		} else if m := rePyAttr.FindStringSubmatch(content); m != nil {
+			if len(stack) > 0 && setPythonPosition(stack[len(stack)-1].node, m[1], m[2]) {
+				continue
+			}
+			node.Field, node.Kind, node.Label = m[1], m[1], m[2]
+		} else {
+			// An element of a list of plain values, such as Global names
+			node.Kind, node.Label = "item", content
+		}
+		entry := indented{depth: depth, node: node}
+		lines = append(lines, entry)
+		stack = append(stack, entry)
+	}
+	return nest(lines)
+}
+
+// setPythonPosition records a position attribute in the node's span
+func setPythonPosition(node *Node, name string, value string) bool {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return false
+	}
+	switch name {
+	case "lineno":
+		node.Span.StartLine = n
+	case "col_offset":
+		node.Span.StartCol = n
+	case "end_lineno":
+		node.Span.EndLine = n
+	case "end_col_offset":
+		node.Span.EndCol = n
+	default:
+		return false
+	}
+	return true
+}
+
+//-- Ruby: `ruby --dump=parsetree`
+
+var (
+	reRbNode     = regexp.MustCompile(`^@ (\w+)(?: \((.*)\))?`)
+	reRbAttr     = regexp.MustCompile(`^\+- (\w+)(?: \(\d+\))?:(?: (.*))?$`)
+	reRbLocation = regexp.MustCompile(`location: \((\d+),(\d+)\)-\((\d+),(\d+)\)`)
+	reRbLine     = regexp.MustCompile(`line: (\d+)`)
+)
+
+func parseRuby(raw string) (*Node, error) {
+	var lines []indented
+	for _, text := range strings.Split(raw, "\n") {
+		if strings.HasPrefix(text, "##") {
+			continue
+		}
+		text = strings.TrimPrefix(strings.TrimPrefix(text, "#"), " ")
+		depth := len(text) - len(strings.TrimLeft(text, " |"))
+		content := strings.TrimSpace(text[depth:])
+		if content == "" {
+			continue
+		}
+
+		node := &Node{}
+		if m := reRbNode.FindStringSubmatch(content); m != nil {
+			node.Kind = m[1]
+			if loc := reRbLocation.FindStringSubmatch(m[2]); loc != nil {
+				node.Span = Span{atoi(loc[1]), atoi(loc[2]), atoi(loc[3]), atoi(loc[4])}
+			} else if line := reRbLine.FindStringSubmatch(m[2]); line != nil {
+				node.Span = Span{StartLine: atoi(line[1]), EndLine: atoi(line[1])}
+			}
+		} else if m := reRbAttr.FindStringSubmatch(content); m != nil {
+			// Attributes sit at the column of their node, and the nodes
+			// held by an attribute are nested beneath it
+			node.Field, node.Kind, node.Label = m[1], m[1], m[2]
+			depth++
+		} else if content == "(null node)" {
+			node.Kind = "null"
+		} else {
+			node.Kind, node.Label = "item", content
+		}
+		lines = append(lines, indented{depth: depth, node: node})
+	}
+	return nest(lines)
+}
+
+//-- Go and tree-sitter: `gotree` and `treesit`, which prefix the line
+
+var (
+	rePrefix = regexp.MustCompile(`^(\d{5}) \| ( *)(.*?) *$`)
+	reGoCtor = regexp.MustCompile(`^(?:(\w+): )?\*ast\.(\w+)$`)
+	reGoList = regexp.MustCompile(`^(\w+): \[\][\w.]+ \(len = \d+\)$`)
+	reGoAttr = regexp.MustCompile(`^(\w+): (.*)$`)
+	reGoPos  = regexp.MustCompile(`^(\d+):(\d+)$`)
+	reIndex  = regexp.MustCompile(`^\d+$`)
+	reTsNode = regexp.MustCompile(`^(?:(\w+): )?\((\w+|"[^"]*")(.*)$`)
+	reTsSpan = regexp.MustCompile(`\t@(\d+):(\d+)-(\d+):(\d+)$`)
+)
+
+// A lineParser interprets the content of one line following the prefix.
+// A nil node skips the line; a true skip also skips everything nested.
+type lineParser func(content string, line int) (node *Node, skip bool)
+
+func parsePrefixed(raw string, parse lineParser) (*Node, error) {
+	var lines []indented
+	skipDepth := -1
+	for _, text := range strings.Split(raw, "\n") {
+		m := rePrefix.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		line, depth, content := atoi(m[1]), len(m[2]), m[3]
+		if skipDepth >= 0 {
+			if depth > skipDepth {
+				continue
+			}
+			skipDepth = -1
+		}
+		node, skip := parse(content, line)
+		if skip {
+			skipDepth = depth
+		}
+		if node != nil {
+			lines = append(lines, indented{depth: depth, node: node})
+		}
+	}
+	root, err := nest(lines)
+	if err != nil {
+		return nil, err
+	}
+	foldPositions(root)
+	return root, nil
+}
+
+// Marks a line giving only the position of the node it is nested within
+const positionKind = "@"
+
+// foldPositions merges position lines into the span of their node.  Where
+// a node has such positions, its attributes take its span rather than the
+// line of the prefix, which carries no column.
+func foldPositions(node *Node) {
+	var kept []*Node
+	var span Span
+	for _, child := range node.Children {
+		if child.Kind == positionKind {
+			span = widen(span, child.Span)
+		} else {
+			kept = append(kept, child)
+		}
+	}
+	node.Children = kept
+	if span.StartLine != 0 {
+		node.Span = span
+		for _, child := range kept {
+			if len(child.Children) == 0 {
+				child.Span = Span{}
+			}
+		}
+	}
+	for _, child := range kept {
+		foldPositions(child)
+	}
+}
+
+func goLine(content string, line int) (*Node, bool) {
+	node := &Node{}
+	if m := reGoCtor.FindStringSubmatch(content); m != nil {
+		// Objects cross-reference declarations by position in the tree
+		if m[1] == "Obj" {
+			return nil, true
+		}
+		// The line shown is the last position before the node, so the
+		// span of a node comes from the values beneath it
+		node.Field, node.Kind = m[1], m[2]
+	} else if m := reGoList.FindStringSubmatch(content); m != nil {
+		node.Field, node.Kind = m[1], "[]"
+	} else if m := reGoAttr.FindStringSubmatch(content); m != nil {
+		if pos := reGoPos.FindStringSubmatch(m[2]); pos != nil {
+			// Columns from go/token count from one
+			l, c := atoi(pos[1]), atoi(pos[2])-1
+			return &Node{Kind: positionKind, Span: Span{l, c, l, c}}, false
+		}
+		if m[1] == "Obj" {
+			return nil, false
+		}
+		node.Field, node.Kind, node.Label = m[1], m[1], m[2]
+		node.Span = Span{StartLine: line, EndLine: line}
+	} else {
+		return nil, false
+	}
+	if reIndex.MatchString(node.Field) {
+		node.Field = ""
+	}
+	return node, false
+}
+
+func treesitLine(content string, line int) (*Node, bool) {
+	span := Span{StartLine: line, EndLine: line}
+	if m := reTsSpan.FindStringSubmatch(content); m != nil {
+		span = Span{atoi(m[1]), atoi(m[2]), atoi(m[3]), atoi(m[4])}
+		content = strings.TrimSuffix(content, m[0])
+	}
+	m := reTsNode.FindStringSubmatch(content)
+	if m == nil {
+		return nil, false
+	}
+	// Parentheses closing this node and its ancestors follow any literal
+	node := &Node{Field: m[1], Kind: m[2], Label: strings.TrimSpace(balanced(m[3]))}
+	if line > 0 {
+		node.Span = span
+	}
+	return node, false
+}
+
+//-- JavaScript: ESTree JSON from acorn
+
+// Properties of ESTree nodes that locate them rather than describe them
+var esPositions = map[string]bool{
+	"type": true, "start": true, "end": true, "loc": true, "range": true,
+}
+
+func parseESTree(raw []byte, position Position) (*Node, error) {
+	var tree interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	root := esNode(tree, "", position)
+	if root == nil {
+		return nil, errors.New("No JavaScript parse tree")
+	}
+	return root, nil
+}
+
+func esNode(value interface{}, field string, position Position) *Node {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		node := &Node{Field: field, Kind: fmt.Sprint(v["type"])}
+		if _, ok := v["type"]; !ok {
+			node.Kind = "{}"
+		}
+		if start, ok := v["start"].(json.Number); ok && position != nil {
+			end, _ := v["end"].(json.Number)
+			s, _ := start.Int64()
+			e, _ := end.Int64()
+			node.Span.StartLine, node.Span.StartCol = position(int(s))
+			node.Span.EndLine, node.Span.EndCol = position(int(e))
+		}
+		var keys []string
+		for key := range v {
+			if !esPositions[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if child := esNode(v[key], key, position); child != nil {
+				node.Children = append(node.Children, child)
+			}
+		}
+		return node
+	case []interface{}:
+		node := &Node{Field: field, Kind: "[]"}
+		for _, elem := range v {
+			if child := esNode(elem, "", position); child != nil {
+				node.Children = append(node.Children, child)
+			}
+		}
+		return node
+	case nil:
+		return &Node{Field: field, Kind: field, Label: "null"}
+	default:
+		return &Node{Field: field, Kind: field, Label: fmt.Sprint(v)}
+	}
+}
+
+// balanced truncates text where a closing bracket outside of any quoted
+// string has no matching opening bracket
+func balanced(text string) string {
+	depth := 0
+	var quote rune
+	escaped := false
+	for i, c := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			if depth == 0 {
+				return text[:i]
+			}
+			depth--
+		}
+	}
+	return text
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
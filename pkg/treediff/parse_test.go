@@ -0,0 +1,220 @@
+package treediff_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+var pythonTree = `Module(
+   body=[
+      Assign(
+         targets=[
+            Name(
+               id='y',
+               ctx=Store(),
+               lineno=2,
+               col_offset=0,
+               end_lineno=2,
+               end_col_offset=1)],
+         value=Constant(
+            value='b)',
+            lineno=2,
+            col_offset=4,
+            end_lineno=2,
+            end_col_offset=9),
+         lineno=2,
+         col_offset=0,
+         end_lineno=2,
+         end_col_offset=9)],
+   type_ignores=[])
+`
+
+func TestParsePython(t *testing.T) {
+	root, err := treediff.Parse([]byte(pythonTree), types.Python, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse Python tree: %s", err)
+	}
+	if root.Kind != "Module" || len(root.Children) != 2 {
+		t.Fatalf("Wrong root %s with %d children", root, len(root.Children))
+	}
+	assign := root.Children[0].Children[0]
+	want := treediff.Span{StartLine: 2, StartCol: 0, EndLine: 2, EndCol: 9}
+	if assign.Kind != "Assign" || assign.Span != want {
+		t.Fatalf("Wrong statement %s at %v", assign, assign.Span)
+	}
+	value := assign.Children[1].Children[0]
+	if value.Label != "'b)'" {
+		t.Fatalf("Quoted bracket not kept in label: %s", value)
+	}
+	// Attributes without positions take those of their node
+	if value.Span.StartCol != 4 {
+		t.Fatalf("Attribute did not inherit span: %v", value.Span)
+	}
+}
+
+var goTree = `SrcLn | Node
+00000 | *ast.File
+00003 |   Name: *ast.Ident
+00003 |     Name: "hello"
+00003 |     Obj: nil
+00003 |   Decls: []ast.Decl (len = 1)
+00005 |     0: *ast.FuncDecl
+00005 |       Name: *ast.Ident
+00007 |         Name: "main"
+00007 |         Obj: *ast.Object
+00007 |           Kind: func
+00007 |           Decl: *(obj @ 30)
+00008 |       Body: *ast.BlockStmt
+00009 |         List: nil
+00009 |   FileStart: 1:1
+`
+
+func TestParseGo(t *testing.T) {
+	root, err := treediff.Parse([]byte(goTree), types.Go, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse Go tree: %s", err)
+	}
+	if root.Kind != "File" || len(root.Children) != 2 {
+		t.Fatalf("Wrong root %s with %d children", root, len(root.Children))
+	}
+	decl := root.Children[1].Children[0]
+	if decl.Kind != "FuncDecl" || decl.Field != "" {
+		t.Fatalf("List index not dropped from %s", decl)
+	}
+	// The object cross-reference and its contents are omitted
+	if decl.Size() != 5 {
+		t.Fatalf("Wrong size %d for %s", decl.Size(), decl)
+	}
+	if decl.Span.StartLine != 7 || decl.Span.EndLine != 9 {
+		t.Fatalf("Wrong span for %s: %v", decl, decl.Span)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	root, err := treediff.Parse([]byte(goTree), types.Go, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse Go tree: %s", err)
+	}
+	out, err := json.Marshal(root.Children[0])
+	if err != nil {
+		t.Fatalf("Failed to write tree as JSON: %s", err)
+	}
+	// Children are written beneath their parents, but not the reverse
+	want := `{"kind":"Ident","field":"Name","span":{"start_line":3,`
+	if !strings.HasPrefix(string(out), want) || !strings.Contains(string(out), `"label":"\"hello\""`) {
+		t.Fatalf("Wrong JSON for %s: %s", root.Children[0], out)
+	}
+}
+
+var rubyTree = `###########################################################
+## Do NOT use this node dump for any purpose other than  ##
+## debug and research.  Compatibility is not guaranteed. ##
+###########################################################
+
+# @ NODE_SCOPE (id: 3, line: 1, location: (1,0)-(3,3))
+# +- nd_tbl: (empty)
+# +- nd_args:
+# |   (null node)
+# +- nd_body:
+#     @ NODE_DEFN (id: 2, line: 1, location: (1,0)-(3,3))*
+#     +- nd_mid: :greet
+#     +- nd_defn:
+#         @ NODE_LIT (id: 1, line: 2, location: (2,2)-(2,4))*
+#         +- nd_lit: 42
+`
+
+func TestParseRuby(t *testing.T) {
+	root, err := treediff.Parse([]byte(rubyTree), types.Ruby, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse Ruby tree: %s", err)
+	}
+	if root.Kind != "NODE_SCOPE" || len(root.Children) != 3 {
+		t.Fatalf("Wrong root %s with %d children", root, len(root.Children))
+	}
+	defn := root.Children[2].Children[0]
+	if defn.Kind != "NODE_DEFN" || defn.Children[0].Label != ":greet" {
+		t.Fatalf("Wrong definition %s", defn)
+	}
+	lit := defn.Children[1].Children[0]
+	want := treediff.Span{StartLine: 2, StartCol: 2, EndLine: 2, EndCol: 4}
+	if lit.Kind != "NODE_LIT" || lit.Span != want {
+		t.Fatalf("Wrong literal %s at %v", lit, lit.Span)
+	}
+}
+
+var treesitTree = `SrcLn | Node
+00001 | (translation_unit
+00001 |   (function_definition
+00001 |     type: (primitive_type)
+00001 |     declarator: (function_declarator
+00001 |       declarator: (identifier main)
+00001 |       parameters: (parameter_list))
+00001 |     body: (compound_statement
+00002 |       (return_statement
+00002 |         (string_literal "a)")))))
+`
+
+func TestParseTreesit(t *testing.T) {
+	root, err := treediff.Parse([]byte(treesitTree), types.Treesit, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse tree-sitter tree: %s", err)
+	}
+	fn := root.Children[0]
+	if fn.Kind != "function_definition" || len(fn.Children) != 3 {
+		t.Fatalf("Wrong definition %s with %d children", fn, len(fn.Children))
+	}
+	ident := fn.Children[1].Children[0]
+	if ident.Field != "declarator" || ident.Label != "main" {
+		t.Fatalf("Wrong identifier %s", ident)
+	}
+	literal := fn.Children[2].Children[0].Children[0]
+	if literal.Label != `"a)"` || literal.Span.StartLine != 2 {
+		t.Fatalf("Wrong literal %s at %v", literal, literal.Span)
+	}
+}
+
+var jsTree = `{
+  "type": "Program",
+  "start": 0,
+  "end": 10,
+  "body": [
+    {
+      "type": "ExpressionStatement",
+      "start": 4,
+      "end": 9,
+      "expression": {
+        "type": "Literal",
+        "start": 4,
+        "end": 8,
+        "value": 42,
+        "raw": "0x2a"
+      }
+    }
+  ],
+  "sourceType": "module"
+}`
+
+func TestParseJavaScript(t *testing.T) {
+	// Two lines of four characters each
+	position := func(offset int) (int, int) {
+		return offset/5 + 1, offset % 5
+	}
+	root, err := treediff.Parse([]byte(jsTree), types.JavaScript, position)
+	if err != nil {
+		t.Fatalf("Failed to parse JavaScript tree: %s", err)
+	}
+	stmt := root.Children[0].Children[0]
+	want := treediff.Span{StartLine: 1, StartCol: 4, EndLine: 2, EndCol: 4}
+	if stmt.Kind != "ExpressionStatement" || stmt.Span != want {
+		t.Fatalf("Wrong statement %s at %v", stmt, stmt.Span)
+	}
+	literal := stmt.Children[0]
+	if literal.Field != "expression" || len(literal.Children) != 2 ||
+		literal.Children[0].String() != "raw(0x2a)" {
+		t.Fatalf("Wrong literal %s with %v", literal, literal.Children)
+	}
+}
@@ -0,0 +1,119 @@
+package treediff
+
+import (
+	"strings"
+)
+
+// Fields naming a member of an object, across the parsers, with the fields
+// which may hold the object, as in `pkg.Foo`
+var memberFields = map[string][]string{
+	"attr":      {"value"},                   // Python
+	"Sel":       {"X"},                       // Go
+	"property":  {"object"},                  // JavaScript and tree-sitter
+	"attribute": {"object"},                  // Tree-sitter Python
+	"field":     {"operand", "argument"},     // Tree-sitter Go and C
+	"name":      {"path", "scope", "object"}, // Tree-sitter Rust and others
+}
+
+// unquote gives the name an identifier's label spells, e.g. foo of 'foo'
+// (Python), "foo" (Go), or :foo (Ruby)
+func unquote(label string) string {
+	return strings.Trim(strings.TrimPrefix(label, ":"), `'"`)
+}
+
+// identLeaf finds the node labelled with the identifier a node names,
+// either itself or one of its attributes
+func identLeaf(n *Node) *Node {
+	if n.Label != "" && isIdentifier(n) {
+		return n
+	}
+	for _, c := range n.Children {
+		if c.Field == c.Kind && c.Label != "" && isIdentifier(c) {
+			return c
+		}
+	}
+	return nil
+}
+
+// member splits a node selecting a member of an object into the two
+func member(n *Node) (*Node, *Node) {
+	for _, c := range n.Children {
+		for _, field := range memberFields[c.Field] {
+			if object := child(n, field); object != nil && identLeaf(c) != nil {
+				return c, object
+			}
+		}
+	}
+	return nil, nil
+}
+
+// dotted spells out the name a node refers to, e.g. "pkg.Foo", or is
+// empty if the node is not a name or a member of something named
+func dotted(n *Node) string {
+	if selected, object := member(n); selected != nil {
+		if qualifier := dotted(object); qualifier != "" {
+			return qualifier + "." + unquote(identLeaf(selected).Label)
+		}
+		return ""
+	}
+	if leaf := identLeaf(n); leaf != nil {
+		return unquote(leaf.Label)
+	}
+	return ""
+}
+
+// respell replaces the name an identifier's label spells, keeping any
+// quotes, and keeps the label as written in Original
+func respell(leaf *Node, name string) {
+	if leaf.Original == "" {
+		leaf.Original = leaf.Label
+	}
+	leaf.Label = strings.Replace(leaf.Label, unquote(leaf.Label), name, 1)
+}
+
+// RenameIdentifiers substitutes names throughout a tree, given a map from
+// old names to new ones.  A plain name, e.g. "Foo", is replaced wherever
+// an identifier spells it, while a dotted one, e.g. "pkg.Foo", is replaced
+// where a member is selected from an object so named; its qualifier is
+// replaced too if that is a plain name.  The names as written remain in
+// Original, and Diff reports them as respellings.
+func RenameIdentifiers(root *Node, renames map[string]string) {
+	if len(renames) == 0 {
+		return
+	}
+	done := map[*Node]bool{}
+	for _, n := range root.PreOrder() {
+		selected, object := member(n)
+		if selected == nil {
+			continue
+		}
+		name := dotted(n)
+		renamed, found := renames[name]
+		if !found || !strings.Contains(name, ".") {
+			continue
+		}
+		oldQualifier := name[:strings.LastIndex(name, ".")]
+		newQualifier, newName := "", renamed
+		if dot := strings.LastIndex(renamed, "."); dot >= 0 {
+			newQualifier, newName = renamed[:dot], renamed[dot+1:]
+		}
+		leaf := identLeaf(selected)
+		respell(leaf, newName)
+		done[leaf] = true
+		if qualifier := identLeaf(object); qualifier != nil &&
+			newQualifier != oldQualifier && !strings.Contains(newQualifier, ".") &&
+			!done[qualifier] {
+			respell(qualifier, newQualifier)
+			done[qualifier] = true
+		}
+	}
+	for _, n := range root.PreOrder() {
+		if n.Label == "" || !isIdentifier(n) || done[n] {
+			continue
+		}
+		if renamed, found := renames[unquote(n.Label)]; found {
+			respell(n, renamed)
+		}
+	}
+	root.Finish()
+}
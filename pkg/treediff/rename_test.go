@@ -0,0 +1,48 @@
+package treediff_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// A tree-sitter style tree of the C statement `function(object.field);`
+const tsCall = `SrcLn | Node
+00001 | (translation_unit
+00001 |   (expression_statement
+00001 |     (call_expression
+00001 |       function: (identifier %s)
+00001 |       arguments: (argument_list
+00001 |         (field_expression
+00001 |           argument: (identifier %s)
+00001 |           field: (field_identifier %s))))))`
+
+func callTree(t *testing.T, function string, object string, field string) *treediff.Node {
+	return fixtureTree(t, types.Treesit, tsCall, function, object, field)
+}
+
+func TestRenameIdentifiers(t *testing.T) {
+	renames := map[string]string{"foo": "bar", "s.count": "s.total"}
+	cases := []struct {
+		src      *treediff.Node
+		dst      *treediff.Node
+		category treediff.Category
+	}{
+		{callTree(t, "foo", "s", "count"), callTree(t, "bar", "s", "total"),
+			treediff.MappedRename},
+		// The member of another object is not renamed
+		{callTree(t, "foo", "u", "count"), callTree(t, "bar", "u", "total"),
+			treediff.Rename},
+		{callTree(t, "foo", "s", "count"), callTree(t, "baz", "s", "total"),
+			treediff.Rename},
+	}
+	for _, c := range cases {
+		treediff.RenameIdentifiers(c.src, renames)
+		edits := treediff.Diff(c.src, c.dst)
+		if category := treediff.ClassifyAll(edits); category != c.category {
+			t.Fatalf("Classified %s as %s rather than %s",
+				describe(edits), category, c.category)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package treediff
+
+import (
+	"strings"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// Suffixes the parsers attach to the kinds of statements and expressions,
+// which are removed to find the root of a kind, e.g. "if" of "IfStmt",
+// "IfStatement", and "if_statement"
+var kindSuffixes = []string{
+	"_statement", "statement", "stmt", "_expression", "expression", "expr",
+}
+
+// kindRoot reduces a node kind to a common spelling across parsers
+func kindRoot(kind string) string {
+	root := strings.TrimPrefix(strings.ToLower(kind), "node_")
+	for _, suffix := range kindSuffixes {
+		if strings.HasSuffix(root, suffix) && root != suffix {
+			root = strings.TrimSuffix(root, suffix)
+			break
+		}
+	}
+	return strings.ReplaceAll(root, "_", "")
+}
+
+// Roots of the kinds of nodes directing control flow
+var controlRoots = map[string]bool{
+	"if": true, "elif": true, "else": true, "elseclause": true,
+	"unless": true, "ifexp": true, "conditional": true, "ternary": true,
+	"for": true, "asyncfor": true, "forin": true, "forof": true,
+	"range": true, "while": true, "dowhile": true, "until": true,
+	"switch": true, "typeswitch": true, "select": true, "case": true,
+	"caseclause": true, "commclause": true, "switchcase": true,
+	"when": true, "match": true, "try": true, "with": true, "asyncwith": true,
+	"raise": true, "throw": true, "rescue": true, "ensure": true,
+	"break": true, "continue": true, "next": true, "redo": true,
+	"retry": true, "branch": true, "go": true, "defer": true,
+}
+
+// Roots of the kinds of nodes that are calls
+var callRoots = map[string]bool{
+	"call": true, "fcall": true, "vcall": true, "opcall": true, "qcall": true,
+	"new": true, "methodinvocation": true,
+}
+
+// Roots of the kinds of nodes whose values leave a function
+var returnRoots = map[string]bool{
+	"return": true, "yield": true, "yieldfrom": true,
+}
+
+// Roots of the kinds of nodes that are boolean conditions
+var conditionRoots = map[string]bool{
+	"compare": true, "boolop": true, "logical": true, "and": true, "or": true,
+	"comparisonoperator": true, "booleanoperator": true,
+}
+
+// Fields holding the test of a branch or loop
+var conditionFields = map[string]bool{
+	"test": true, "cond": true, "Cond": true, "condition": true,
+	"nd_cond": true,
+}
+
+// Python statements, which lack any common suffix
+var pythonStatements = map[string]bool{
+	"Expr": true, "Assign": true, "AugAssign": true, "AnnAssign": true,
+	"Return": true, "If": true, "For": true, "AsyncFor": true, "While": true,
+	"With": true, "AsyncWith": true, "Try": true, "TryStar": true,
+	"Raise": true, "Assert": true, "Delete": true, "Import": true,
+	"ImportFrom": true, "Global": true, "Nonlocal": true, "Pass": true,
+	"Break": true, "Continue": true, "Match": true,
+}
+
+// isStatement is true of nodes which bound the context of a change
+func isStatement(n *Node) bool {
+	kind := n.Kind
+	for _, suffix := range []string{
+		"Stmt", "Statement", "_statement", "Decl", "Declaration",
+		"_declaration", "_definition", "Def"} {
+		if strings.HasSuffix(kind, suffix) {
+			return true
+		}
+	}
+	// Ruby statements are the children of a block
+	return pythonStatements[kind] || (n.Parent != nil && n.Parent.Kind == "NODE_BLOCK")
+}
+
+// nature is the kind of risk of a control flow, call, or literal node
+func nature(n *Node) string {
+	root := kindRoot(n.Kind)
+	switch {
+	case controlRoots[root]:
+		return types.RiskControl
+	case callRoots[root]:
+		return types.RiskCall
+	case isLiteral(n):
+		return types.RiskLiteral
+	}
+	return ""
+}
+
+// context is the kind of risk of a node which encloses a condition or a
+// returned value, if any
+func context(n *Node) string {
+	root := kindRoot(n.Kind)
+	switch {
+	case conditionFields[n.Field] || conditionRoots[root]:
+		return types.RiskCondition
+	case returnRoots[root]:
+		return types.RiskReturn
+	}
+	return ""
+}
+
+// RiskKinds finds the kinds of risk an edit carries.  The nearest control
+// flow, call, or literal node, from the changed node up to its statement,
+// gives the nature of the change, while an enclosing condition or returned
+// value adds to it.  An inserted or deleted subtree is at least of "other"
+// risk, and carries the risks of everything within it too.
+func RiskKinds(e Edit) []string {
+	node := e.Dst
+	if node == nil {
+		node = e.Src
+	}
+	var kinds []string
+	found := false
+	for n := node; n != nil; n = n.Parent {
+		if kind := nature(n); kind != "" && !found {
+			kinds = append(kinds, kind)
+			found = true
+		}
+		if kind := context(n); kind != "" {
+			kinds = append(kinds, kind)
+		}
+		if isStatement(n) {
+			break
+		}
+	}
+	if e.Op == Insert || e.Op == Delete {
+		kinds = append(kinds, types.RiskOther)
+		for _, n := range node.PreOrder()[1:] {
+			for _, kind := range []string{nature(n), context(n)} {
+				if kind != "" {
+					kinds = append(kinds, kind)
+				}
+			}
+		}
+	}
+	if len(kinds) == 0 {
+		return []string{types.RiskOther}
+	}
+	return kinds
+}
+
+// Risk scores a group of edits by the weightiest kind of risk among them.
+// Edits that are not semantic carry none.
+func Risk(edits []Edit, weights map[string]float64) float64 {
+	score := 0.0
+	for _, edit := range edits {
+		if !Semantic(edit) {
+			continue
+		}
+		for _, kind := range RiskKinds(edit) {
+			if weights[kind] > score {
+				score = weights[kind]
+			}
+		}
+	}
+	return score
+}
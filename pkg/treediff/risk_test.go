@@ -0,0 +1,44 @@
+package treediff_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// A branch whose condition and logged message may be varied
+const tsBranch = `SrcLn | Node
+00001 | (module
+00001 |   (if_statement
+00001 |     condition: (comparison_operator
+00001 |       (identifier x)
+00001 |       (integer_literal %s))
+00002 |     consequence: (block
+00002 |       (expression_statement
+00002 |         (call
+00002 |           function: (identifier log)
+00002 |           arguments: (string_literal %s))))))`
+
+func branchTree(t *testing.T, limit string, message string) *treediff.Node {
+	return fixtureTree(t, types.Treesit, tsBranch, limit, message)
+}
+
+func TestRisk(t *testing.T) {
+	weights := types.Config{}.Weights("treesit")
+	src := branchTree(t, "1", `"big"`)
+	message := treediff.Diff(src, branchTree(t, "1", `"large"`))
+	limit := treediff.Diff(src, branchTree(t, "2", `"big"`))
+	if risk := treediff.Risk(message, weights); risk != weights[types.RiskLiteral] {
+		t.Fatalf("Changed message has risk %g", risk)
+	}
+	if risk := treediff.Risk(limit, weights); risk != weights[types.RiskCondition] {
+		t.Fatalf("Changed condition has risk %g", risk)
+	}
+
+	config := types.Config{Risk: map[string]map[string]float64{
+		"treesit": {types.RiskLiteral: 7}}}
+	if risk := treediff.Risk(message, config.Weights("treesit")); risk != 7 {
+		t.Fatalf("Configured weight ignored, risk is %g", risk)
+	}
+}
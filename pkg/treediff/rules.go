@@ -0,0 +1,381 @@
+package treediff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// Pattern is one side of a rewrite rule, a tree written as an S-expression
+// in the manner of `treesit`, e.g. `(call_expression function: (identifier
+// log) arguments: $ARGS)`.  A node is its kind, any label, and its
+// children, each optionally preceded by its field; `field: atom` is the
+// attribute of that name with that label, as Python's `id: 'x'`.  The kind
+// "_" matches any node, and "..." ends a list of children matching any
+// further unfielded ones.  Metavariables such as $X stand for a node, but
+// one alone within a node matching a leaf, as in `(identifier $X)`, stands
+// for its label.  A metavariable used twice must match the same content
+// each time, and $_ matches anything.
+type Pattern struct {
+	Kind     string
+	Field    string
+	Label    string
+	Var      string // Metavariable standing for the whole node
+	Children []*Pattern
+	Rest     bool // Further unfielded children are allowed
+}
+
+// Rule rewrites subtrees matching one pattern into another, so that
+// constructs a team considers equivalent compare equal
+type Rule struct {
+	Name    string
+	Match   *Pattern
+	Replace *Pattern
+}
+
+// Firing records a rule rewriting a subtree, where it was written
+type Firing struct {
+	Rule string
+	Span Span
+}
+
+// Most rewrites of the same place, lest rules undo one another forever
+const maxRewrites = 8
+
+// tokenize splits a pattern into parentheses, fields, and atoms, where a
+// quoted atom keeps its quotes and may hold spaces
+func tokenize(text string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(text) && text[end] != c {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, fmt.Errorf("Unterminated quote in %q", text)
+			}
+			tokens = append(tokens, text[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(text) && !strings.ContainsRune(" \t\n\r()", rune(text[end])) {
+				end++
+			}
+			tokens = append(tokens, text[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+func isField(token string) bool {
+	return len(token) > 1 && strings.HasSuffix(token, ":") && !strings.ContainsAny(token[:1], `'"`)
+}
+
+func isVar(token string) bool {
+	return len(token) > 1 && token[0] == '$'
+}
+
+// ParsePattern reads a pattern written as an S-expression
+func ParsePattern(text string) (*Pattern, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	pattern, rest, err := parseChild(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("Unexpected %q after pattern", strings.Join(rest, " "))
+	}
+	return pattern, nil
+}
+
+// parseChild reads one child of a pattern, with any field, returning the
+// tokens that follow it
+func parseChild(tokens []string) (*Pattern, []string, error) {
+	field := ""
+	if len(tokens) > 0 && isField(tokens[0]) {
+		field, tokens = strings.TrimSuffix(tokens[0], ":"), tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("Pattern ends early")
+	}
+	token := tokens[0]
+	switch {
+	case token == "(":
+		pattern, rest, err := parseNode(tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		pattern.Field = field
+		return pattern, rest, nil
+	case token == ")":
+		return nil, nil, fmt.Errorf("Unexpected )")
+	case isVar(token):
+		return &Pattern{Field: field, Var: token}, tokens[1:], nil
+	case field != "":
+		return &Pattern{Kind: field, Field: field, Label: token}, tokens[1:], nil
+	}
+	return nil, nil, fmt.Errorf("Bare %q where a node was expected", token)
+}
+
+// parseNode reads a node after its opening parenthesis
+func parseNode(tokens []string) (*Pattern, []string, error) {
+	if len(tokens) == 0 || tokens[0] == "(" || tokens[0] == ")" || isField(tokens[0]) {
+		return nil, nil, fmt.Errorf("A node must begin with its kind")
+	}
+	pattern := &Pattern{Kind: tokens[0]}
+	tokens = tokens[1:]
+	if len(tokens) > 0 && tokens[0] != "(" && tokens[0] != ")" && tokens[0] != "..." &&
+		!isField(tokens[0]) && !isVar(tokens[0]) {
+		pattern.Label, tokens = tokens[0], tokens[1:]
+	}
+	for {
+		if len(tokens) == 0 {
+			return nil, nil, fmt.Errorf("Unbalanced ( in pattern")
+		}
+		switch tokens[0] {
+		case ")":
+			return pattern, tokens[1:], nil
+		case "...":
+			pattern.Rest = true
+			tokens = tokens[1:]
+			continue
+		}
+		child, rest, err := parseChild(tokens)
+		if err != nil {
+			return nil, nil, err
+		}
+		pattern.Children = append(pattern.Children, child)
+		tokens = rest
+	}
+}
+
+// vars lists the metavariables of a pattern
+func (p *Pattern) vars(names map[string]bool) {
+	if p.Var != "" {
+		names[p.Var] = true
+	}
+	for _, c := range p.Children {
+		c.vars(names)
+	}
+}
+
+// labelVar gives the metavariable standing alone within a node, which
+// stands for the label of a leaf
+func (p *Pattern) labelVar() string {
+	if len(p.Children) == 1 && p.Children[0].Var != "" && p.Children[0].Field == "" && !p.Rest {
+		return p.Children[0].Var
+	}
+	return ""
+}
+
+// anywhere is true if some node of a pattern satisfies a test
+func (p *Pattern) anywhere(test func(*Pattern) bool) bool {
+	if test(p) {
+		return true
+	}
+	for _, c := range p.Children {
+		if c.anywhere(test) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompileRules parses the rules configured for a language.  Every
+// metavariable of a replacement must be bound by its match, and the
+// replacement must say exactly what to build.
+func CompileRules(configured []types.Rule, language string) ([]Rule, error) {
+	var rules []Rule
+	for _, r := range configured {
+		if r.Language != language {
+			continue
+		}
+		match, err := ParsePattern(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("Rule %s: match: %s", r.Name, err)
+		}
+		replace, err := ParsePattern(r.Replace)
+		if err != nil {
+			return nil, fmt.Errorf("Rule %s: replace: %s", r.Name, err)
+		}
+		if match.Var != "" {
+			return nil, fmt.Errorf("Rule %s: match must be a node, not %s", r.Name, match.Var)
+		}
+		bound, used := map[string]bool{}, map[string]bool{}
+		match.vars(bound)
+		replace.vars(used)
+		for name := range used {
+			if !bound[name] || name == "$_" {
+				return nil, fmt.Errorf("Rule %s: %s is not bound by the match", r.Name, name)
+			}
+		}
+		if replace.anywhere(func(p *Pattern) bool { return p.Kind == "_" || p.Rest }) {
+			return nil, fmt.Errorf("Rule %s: replace may not use _ or ...", r.Name)
+		}
+		rules = append(rules, Rule{Name: r.Name, Match: match, Replace: replace})
+	}
+	return rules, nil
+}
+
+// bindings are the subtrees and labels the metavariables of a match stand for
+type bindings struct {
+	nodes  map[string]*Node
+	labels map[string]string
+}
+
+// match tests a node against a pattern, binding its metavariables
+func (p *Pattern) match(n *Node, b bindings) bool {
+	if p.Var != "" {
+		if p.Var == "$_" {
+			return true
+		}
+		if bound, found := b.nodes[p.Var]; found {
+			return Fingerprint(bound) == Fingerprint(n)
+		}
+		b.nodes[p.Var] = n
+		return true
+	}
+	if p.Kind != "_" && p.Kind != n.Kind {
+		return false
+	}
+	if p.Label != "" && p.Label != n.Label {
+		return false
+	}
+	if name := p.labelVar(); name != "" && len(n.Children) == 0 && n.Label != "" {
+		if bound, found := b.labels[name]; found && bound != n.Label {
+			return false
+		}
+		if name != "$_" {
+			b.labels[name] = n.Label
+		}
+		return true
+	}
+	var unfielded []*Node
+	for _, c := range n.Children {
+		if c.Field == "" {
+			unfielded = append(unfielded, c)
+		}
+	}
+	i := 0
+	for _, pc := range p.Children {
+		if pc.Field != "" {
+			c := child(n, pc.Field)
+			if c == nil || !pc.match(c, b) {
+				return false
+			}
+			continue
+		}
+		if i >= len(unfielded) || !pc.match(unfielded[i], b) {
+			return false
+		}
+		i++
+	}
+	return i == len(unfielded) || p.Rest
+}
+
+// clone copies a subtree, detached from its parent
+func clone(n *Node) *Node {
+	copied := *n
+	copied.Parent = nil
+	copied.Children = nil
+	for _, c := range n.Children {
+		copied.Children = append(copied.Children, clone(c))
+	}
+	return &copied
+}
+
+// build makes the subtree a replacement pattern describes
+func (p *Pattern) build(b bindings) *Node {
+	if p.Var != "" {
+		bound, found := b.nodes[p.Var]
+		if !found {
+			// Where the match bound only a label, this is an attribute
+			return &Node{Kind: p.Field, Field: p.Field, Label: b.labels[p.Var]}
+		}
+		n := clone(bound)
+		n.Field = p.Field
+		return n
+	}
+	n := &Node{Kind: p.Kind, Field: p.Field, Label: p.Label}
+	if name := p.labelVar(); name != "" {
+		if label, found := b.labels[name]; found {
+			n.Label = label
+			return n
+		}
+	}
+	for _, c := range p.Children {
+		n.Children = append(n.Children, c.build(b))
+	}
+	return n
+}
+
+// rewrite replaces a node by the first rule matching it, if any, giving
+// the replacement and the rule
+func rewrite(n *Node, rules []Rule) (*Node, string) {
+	for _, rule := range rules {
+		b := bindings{nodes: map[string]*Node{}, labels: map[string]string{}}
+		if !rule.Match.match(n, b) {
+			continue
+		}
+		replacement := rule.Replace.build(b)
+		if rule.Replace.Field == "" {
+			replacement.Field = n.Field
+		}
+		replacement.Span = n.Span
+		replacement.Parent = n.Parent
+		for i, c := range n.Parent.Children {
+			if c == n {
+				n.Parent.Children[i] = replacement
+			}
+		}
+		return replacement, rule.Name
+	}
+	return nil, ""
+}
+
+// ApplyRules rewrites a tree by the rules, innermost subtrees first, and
+// again wherever a rewrite produces something another rule matches.  It
+// lists where each rule fired, by the span of the subtree it rewrote.
+func ApplyRules(root *Node, rules []Rule) []Firing {
+	if len(rules) == 0 {
+		return nil
+	}
+	var fired []Firing
+	for _, n := range root.PostOrder() {
+		if n.Parent == nil {
+			continue
+		}
+		span := n.Span
+		for i := 0; i < maxRewrites; i++ {
+			replacement, name := rewrite(n, rules)
+			if replacement == nil {
+				break
+			}
+			replacement.Finish()
+			// Ancestors matched later must see the content as rewritten
+			for p := replacement.Parent; p != nil; p = p.Parent {
+				p.summarize()
+			}
+			fired = append(fired, Firing{Rule: name, Span: span})
+			n = replacement
+		}
+	}
+	root.Finish()
+	return fired
+}
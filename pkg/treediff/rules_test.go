@@ -0,0 +1,92 @@
+package treediff_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// Unwraps calls of a function, e.g. `wrap(x)` as `x`
+var unwrap = types.Rule{
+	Name:     "unwrap",
+	Language: "treesit",
+	Match:    "(call_expression function: (identifier wrap) arguments: (argument_list $X))",
+	Replace:  "$X",
+}
+
+// Calls a method of an object named as the method is, e.g. `s(s.count)`
+var selfCall = types.Rule{
+	Name:     "self-call",
+	Language: "treesit",
+	Match: `(call_expression function: (identifier $F)
+	  arguments: (argument_list (field_expression argument: (identifier $F) ...)))`,
+	Replace: "(identifier $F)",
+}
+
+// A tree-sitter style tree of the C statement `object.field;`
+const tsField = `SrcLn | Node
+00001 | (translation_unit
+00001 |   (expression_statement
+00001 |     (field_expression
+00001 |       argument: (identifier %s)
+00001 |       field: (field_identifier %s))))`
+
+func TestApplyRules(t *testing.T) {
+	rules, err := treediff.CompileRules([]types.Rule{unwrap, selfCall}, "treesit")
+	if err != nil || len(rules) != 2 {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	cases := []struct {
+		tree  *treediff.Node
+		fired string
+		kind  string
+	}{
+		{callTree(t, "wrap", "s", "count"), "unwrap", "field_expression"},
+		{callTree(t, "s", "s", "count"), "self-call", "identifier"},
+		{callTree(t, "wrapped", "s", "count"), "", "call_expression"},
+		{callTree(t, "t", "s", "count"), "", "call_expression"},
+	}
+	for _, c := range cases {
+		fired := treediff.ApplyRules(c.tree, rules)
+		statement := c.tree.Children[0]
+		if kind := statement.Children[0].Kind; kind != c.kind {
+			t.Fatalf("Rewrote to %s rather than %s", kind, c.kind)
+		}
+		if c.fired == "" && len(fired) > 0 {
+			t.Fatalf("Rule %s fired unexpectedly", fired[0].Rule)
+		}
+		if c.fired != "" && (len(fired) != 1 || fired[0].Rule != c.fired) {
+			t.Fatalf("Rule %s did not fire alone: %v", c.fired, fired)
+		}
+	}
+
+	// The wrapped spelling becomes the unwrapped one
+	src := callTree(t, "wrap", "s", "count")
+	dst := fixtureTree(t, types.Treesit, tsField, "s", "count")
+	if edits := treediff.Diff(src, dst); len(edits) == 0 {
+		t.Fatalf("Wrapped and unwrapped trees do not differ")
+	}
+	treediff.ApplyRules(src, rules)
+	if edits := treediff.Diff(src, dst); len(edits) != 0 {
+		t.Fatalf("Rewritten tree differs from the unwrapped one: %s", describe(edits))
+	}
+}
+
+func TestCompileRules(t *testing.T) {
+	bad := []types.Rule{
+		{Name: "unbound", Language: "go", Match: "(CallExpr Fun: $F)", Replace: "$G"},
+		{Name: "wildcard", Language: "go", Match: "(CallExpr Fun: $F)", Replace: "(_ X: $F)"},
+		{Name: "unbalanced", Language: "go", Match: "(CallExpr Fun: $F", Replace: "$F"},
+		{Name: "bare", Language: "go", Match: "$F", Replace: "$F"},
+	}
+	for _, rule := range bad {
+		if _, err := treediff.CompileRules([]types.Rule{rule}, "go"); err == nil {
+			t.Fatalf("Rule %s compiled", rule.Name)
+		}
+	}
+	// Rules of other languages are not compiled
+	if rules, err := treediff.CompileRules(bad, "python"); err != nil || len(rules) != 0 {
+		t.Fatalf("Rules of another language compiled: %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package treediff
+
+import (
+	"strings"
+)
+
+// Declaration is a named definition, such as a function or class, to
+// which changes within it are attributed
+type Declaration struct {
+	Keyword string // e.g. "func", "class", "method", "table"
+	Name    string
+	Node    *Node
+}
+
+func (d Declaration) String() string {
+	return d.Keyword + " " + d.Name
+}
+
+// Words of tree-sitter node kinds that declare something named, once
+// suffixes such as "_definition" are removed, e.g. "function_definition",
+// "class_declaration", "struct_item", or "create_table"
+var declarationWords = map[string]bool{
+	"function": true, "method": true, "constructor": true, "class": true,
+	"struct": true, "enum": true, "union": true, "interface": true,
+	"trait": true, "impl": true, "module": true, "namespace": true,
+	"table": true, "view": true, "index": true, "column": true,
+	"trigger": true, "procedure": true,
+}
+
+// Keywords of declarations within which a function is a method
+var containerKeywords = map[string]bool{
+	"class": true, "module": true, "struct": true, "interface": true,
+	"trait": true, "impl": true,
+}
+
+// child finds the child of a node in a field
+func child(n *Node, field string) *Node {
+	for _, c := range n.Children {
+		if c.Field == field {
+			return c
+		}
+	}
+	return nil
+}
+
+// firstLabel finds the label of the first node within a subtree, in
+// pre-order, holding one of the fields
+func firstLabel(n *Node, fields ...string) string {
+	if n == nil {
+		return ""
+	}
+	for _, d := range n.PreOrder() {
+		for _, field := range fields {
+			if d.Field == field && d.Label != "" {
+				return strings.Trim(strings.TrimPrefix(d.Label, ":"), `'"`)
+			}
+		}
+	}
+	return ""
+}
+
+// treesitDeclaration recognizes declarations among tree-sitter node kinds,
+// named by a "name" field or else by the first identifier within them.  The
+// root is the file, even if its kind, e.g. "module", suggests otherwise.
+func treesitDeclaration(n *Node) (string, string) {
+	if n.Kind != strings.ToLower(n.Kind) || len(n.Children) == 0 || n.Parent == nil {
+		return "", ""
+	}
+	word := strings.TrimPrefix(n.Kind, "create_")
+	for _, suffix := range []string{
+		"_definition", "_declaration", "_item", "_specifier", "_statement"} {
+		word = strings.TrimSuffix(word, suffix)
+	}
+	if !declarationWords[word] {
+		return "", ""
+	}
+	if name := firstLabel(child(n, "name"), "name"); name != "" {
+		return word, name
+	}
+	for _, d := range n.PreOrder()[1:] {
+		if strings.HasSuffix(d.Kind, "identifier") && d.Label != "" {
+			return word, d.Label
+		}
+	}
+	return "", ""
+}
+
+// DeclarationOf recognizes a node that declares something named, in the
+// trees of any of the parsers
+func DeclarationOf(n *Node) (Declaration, bool) {
+	var keyword, name string
+	switch n.Kind {
+	// Python
+	case "FunctionDef", "AsyncFunctionDef":
+		keyword, name = "function", firstLabel(child(n, "name"), "name")
+	case "ClassDef":
+		keyword, name = "class", firstLabel(child(n, "name"), "name")
+	// Go
+	case "FuncDecl":
+		keyword, name = "func", firstLabel(child(n, "Name"), "Name")
+		// The type of the receiver, not its variable, qualifies a method
+		if recv := child(n, "Recv"); recv != nil {
+			for _, field := range recv.PreOrder() {
+				if field.Field == "Type" {
+					keyword, name = "method", firstLabel(field, "Name")+"."+name
+					break
+				}
+			}
+		}
+	case "TypeSpec":
+		keyword, name = "type", firstLabel(child(n, "Name"), "Name")
+	case "ValueSpec":
+		keyword = "var"
+		if n.Parent != nil && n.Parent.Parent != nil {
+			if tok := child(n.Parent.Parent, "Tok"); tok != nil {
+				keyword = tok.Label
+			}
+		}
+		var names []string
+		if list := child(n, "Names"); list != nil {
+			for _, ident := range list.Children {
+				names = append(names, firstLabel(ident, "Name"))
+			}
+		}
+		name = strings.Join(names, ", ")
+	// JavaScript
+	case "FunctionDeclaration":
+		keyword, name = "function", firstLabel(child(n, "id"), "name")
+	case "ClassDeclaration":
+		keyword, name = "class", firstLabel(child(n, "id"), "name")
+	case "MethodDefinition":
+		keyword, name = "method", firstLabel(child(n, "key"), "name", "value")
+	case "VariableDeclarator":
+		keyword, name = "var", firstLabel(child(n, "id"), "name")
+		if n.Parent != nil && n.Parent.Parent != nil {
+			if kind := child(n.Parent.Parent, "kind"); kind != nil {
+				keyword = kind.Label
+			}
+		}
+	// Ruby
+	case "NODE_DEFN", "NODE_DEFS":
+		keyword, name = "function", firstLabel(n, "nd_mid")
+	case "NODE_CLASS":
+		keyword, name = "class", firstLabel(n, "nd_mid")
+	case "NODE_MODULE":
+		keyword, name = "module", firstLabel(n, "nd_mid")
+	default:
+		keyword, name = treesitDeclaration(n)
+	}
+	if keyword == "" || name == "" {
+		return Declaration{}, false
+	}
+	return Declaration{Keyword: keyword, Name: name, Node: n}, true
+}
+
+// enclosing lists the declarations enclosing a node, innermost first, and
+// including the node itself.  Functions within classes become methods.
+func enclosing(n *Node) []Declaration {
+	var decls []Declaration
+	for ; n != nil; n = n.Parent {
+		if decl, ok := DeclarationOf(n); ok {
+			decls = append(decls, decl)
+		}
+	}
+	for i := range decls {
+		if decls[i].Keyword == "function" && i+1 < len(decls) &&
+			containerKeywords[decls[i+1].Keyword] {
+			decls[i].Keyword = "method"
+		}
+	}
+	return decls
+}
+
+// outermost lists the declarations within a subtree not within another
+// declaration of the subtree
+func outermost(n *Node) []*Node {
+	if _, ok := DeclarationOf(n); ok {
+		return []*Node{n}
+	}
+	var found []*Node
+	for _, c := range n.Children {
+		found = append(found, outermost(c)...)
+	}
+	return found
+}
+
+// scoped describes a change to a declaration, within the scope of the
+// declaration enclosing it, if any
+func scoped(decls []Declaration, change string) string {
+	switch len(decls) {
+	case 0:
+		return "top level: " + change
+	case 1:
+		return decls[0].String() + ": " + change
+	}
+	return decls[1].String() + ": " + decls[0].String() + " " + change
+}
+
+// Symbols attributes each edit to its enclosing named declaration, giving
+// one line per declaration and change, e.g. "func main: modified" or
+// "class Foo: method bar added".  Declarations are found in the trees of
+// the side of the edit, so a removed declaration is named as it was.
+func Symbols(edits []Edit) []string {
+	var lines []string
+	seen := map[string]bool{}
+	report := func(line string) {
+		if !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+	for _, edit := range edits {
+		node, change := edit.Dst, "added"
+		if node == nil {
+			node, change = edit.Src, "removed"
+		}
+		switch edit.Op {
+		case Insert, Delete:
+			decls := outermost(node)
+			if len(decls) == 0 {
+				report(scoped(enclosing(node), "modified"))
+			}
+			for _, decl := range decls {
+				report(scoped(enclosing(decl), change))
+			}
+		case Move, Relocate:
+			if _, ok := DeclarationOf(node); ok {
+				report(scoped(enclosing(node), "moved"))
+			} else {
+				report(scoped(enclosing(node), "modified"))
+			}
+		case Respell:
+			report(scoped(enclosing(node), Classify(edit).String()))
+		default:
+			report(scoped(enclosing(node), "modified"))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,85 @@
+package treediff_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// tableTree renders a tree-sitter style tree of a table with columns
+func tableTree(t *testing.T, columns ...string) *treediff.Node {
+	lines := []string{
+		"SrcLn | Node",
+		"00001 | (program",
+		"00001 |   (create_table",
+		"00001 |     (object_reference",
+		"00001 |       name: (identifier orders))",
+		"00002 |     (column_definitions",
+	}
+	for _, column := range columns {
+		lines = append(lines,
+			"00002 |       (column_definition",
+			"00002 |         name: (identifier "+column+")",
+			"00002 |         type: (int))")
+	}
+	lines[len(lines)-1] += ")))"
+	return fixtureTree(t, types.Treesit, "%s", strings.Join(lines, "\n"))
+}
+
+func TestSymbols(t *testing.T) {
+	cases := []struct {
+		src     *treediff.Node
+		dst     *treediff.Node
+		symbols string
+	}{
+		{pyTree(t, "'Doc'", "1"), pyTree(t, "'Doc'", "2"), "function f: modified"},
+		{tableTree(t, "id"), tableTree(t, "id", "total"), "table orders: column total added"},
+		{tableTree(t, "id", "total"), tableTree(t, "id"), "table orders: column total removed"},
+	}
+	for _, c := range cases {
+		edits := treediff.Diff(c.src, c.dst)
+		symbols := strings.Join(treediff.Symbols(edits), "; ")
+		if symbols != c.symbols {
+			t.Fatalf("Symbols of %s are %q rather than %q",
+				describe(edits), symbols, c.symbols)
+		}
+	}
+}
+
+// functionTree renders a tree-sitter style tree of functions, each given
+// as name=value for the value it returns
+func functionTree(t *testing.T, functions ...string) *treediff.Node {
+	var tree strings.Builder
+	tree.WriteString("SrcLn | Node\n00001 | (module\n")
+	for i, function := range functions {
+		parts := strings.Split(function, "=")
+		fmt.Fprintf(&tree, "%05d |   (function_definition\n", i+1)
+		fmt.Fprintf(&tree, "%05d |     name: (identifier %s)\n", i+1, parts[0])
+		fmt.Fprintf(&tree, "%05d |     body: (return_statement\n", i+1)
+		fmt.Fprintf(&tree, "%05d |       (integer %s)))\n", i+1, parts[1])
+	}
+	return fixtureTree(t, types.Treesit, "%s)", tree.String())
+}
+
+func TestRelocateDeclarations(t *testing.T) {
+	src := functionTree(t, "a=1", "b=2", "c=3")
+	edits := treediff.RelocateDeclarations(
+		treediff.Diff(src, functionTree(t, "c=3", "a=1", "b=2")), true)
+	if len(edits) != 1 || edits[0].Op != treediff.Relocate {
+		t.Fatalf("Expected one relocation, got: %s", describe(edits))
+	}
+	if symbols := treediff.Symbols(edits); symbols[0] != "function c: moved" {
+		t.Fatalf("Relocation described as %q", symbols)
+	}
+
+	// Moved and changed, the function is still paired by its name
+	edits = treediff.RelocateDeclarations(
+		treediff.Diff(src, functionTree(t, "c=4", "a=1", "b=2")), true)
+	if len(edits) != 2 || edits[0].Op != treediff.Relocate ||
+		edits[1].Op != treediff.Update || edits[1].Dst.Label != "4" {
+		t.Fatalf("Expected a relocation and update, got: %s", describe(edits))
+	}
+}
@@ -0,0 +1,116 @@
+package treediff
+
+import (
+	"sort"
+	"strings"
+)
+
+// unorderedGroups lists the groups of a node's children whose order has no
+// meaning, given the configured kinds.  An entry "Kind" groups the children
+// of that kind, e.g. "ImportSpec", while "Parent.child" does so only within
+// a node of the parent kind, the child naming either a kind or a field,
+// e.g. "block.declaration" or "Set.elts".  A child so named that is a list
+// contributes its elements rather than itself.
+func unorderedGroups(n *Node, kinds []string) [][]*Node {
+	var groups [][]*Node
+	for _, entry := range kinds {
+		parent, name, scoped := strings.Cut(entry, ".")
+		if !scoped {
+			parent, name = "", entry
+		}
+		if parent != "" && parent != n.Kind {
+			continue
+		}
+		var group []*Node
+		for _, c := range n.Children {
+			switch {
+			case c.Kind == name:
+				group = append(group, c)
+			case parent != "" && c.Field == name && c.Kind == "[]":
+				groups = append(groups, c.Children)
+			case parent != "" && c.Field == name:
+				group = append(group, c)
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// SortUnordered puts the children of a tree's unordered groups into an
+// order given by their content, so that two trees differing only in the
+// order of such children are the same.  The spans of the children are not
+// changed, so edits within them are still found on the lines written.
+func SortUnordered(root *Node, kinds []string) {
+	if len(kinds) == 0 {
+		return
+	}
+	for _, n := range root.PostOrder() {
+		for _, group := range unorderedGroups(n, kinds) {
+			sortGroup(group, kinds)
+		}
+	}
+	root.Finish()
+}
+
+// sortGroup reorders the nodes of a group within the places they occupy
+// among their siblings.  Their hashes reflect any sorting beneath them.
+func sortGroup(group []*Node, kinds []string) {
+	parent := group[0].Parent
+	for _, n := range group {
+		n.finish()
+	}
+	sorted := append([]*Node{}, group...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].hash < sorted[j].hash
+	})
+	places := map[*Node]int{}
+	for _, n := range group {
+		places[n] = len(places)
+	}
+	for i, c := range parent.Children {
+		if place, found := places[c]; found {
+			parent.Children[i] = sorted[place]
+		}
+	}
+}
+
+// DropUnorderedMoves removes the moves of children within unordered groups,
+// which arise where some among them were modified and so sorted elsewhere
+func DropUnorderedMoves(edits []Edit, kinds []string) []Edit {
+	if len(kinds) == 0 {
+		return edits
+	}
+	var kept []Edit
+	for _, edit := range edits {
+		if edit.Op == Move && inUnorderedGroup(edit.Src, kinds) &&
+			inUnorderedGroup(edit.Dst, kinds) && edit.Src.Parent.Kind == edit.Dst.Parent.Kind {
+			continue
+		}
+		kept = append(kept, edit)
+	}
+	return kept
+}
+
+// inUnorderedGroup is true of a node whose order among some of its
+// siblings has no meaning
+func inUnorderedGroup(n *Node, kinds []string) bool {
+	if n.Parent == nil {
+		return false
+	}
+	for _, p := range []*Node{n.Parent, n.Parent.Parent} {
+		if p == nil {
+			continue
+		}
+		for _, group := range unorderedGroups(p, kinds) {
+			for _, member := range group {
+				if member == n {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package treediff_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// A tree-sitter style tree of the CSS rule `p { one: 1; two: 2; }`
+const tsRule = `SrcLn | Node
+00001 | (stylesheet
+00001 |   (rule_set
+00001 |     (selectors
+00001 |       (tag_name))
+00001 |     (block
+00002 |       (declaration
+00002 |         (property_name)
+00002 |         (integer_value %s))
+00003 |       (declaration
+00003 |         (property_name)
+00003 |         (string_value %s)))))`
+
+func ruleTree(t *testing.T, one string, two string) *treediff.Node {
+	return fixtureTree(t, types.Treesit, tsRule, one, two)
+}
+
+func TestSortUnordered(t *testing.T) {
+	kinds := types.UnorderedKinds["treesit"]
+	src, dst := ruleTree(t, "1", "2"), ruleTree(t, "1", "2")
+	block := dst.Children[0].Children[1]
+	block.Children[0], block.Children[1] = block.Children[1], block.Children[0]
+	dst.Finish()
+	if edits := treediff.Diff(src, dst); len(edits) == 0 {
+		t.Fatalf("Reordered declarations are the same before sorting")
+	}
+	treediff.SortUnordered(src, kinds)
+	treediff.SortUnordered(dst, kinds)
+	if edits := treediff.Diff(src, dst); len(edits) != 0 {
+		t.Fatalf("Reordered declarations differ: %s", describe(edits))
+	}
+
+	// A modified declaration sorted elsewhere is not also moved
+	dst = ruleTree(t, "1", "3")
+	block = dst.Children[0].Children[1]
+	block.Children[0], block.Children[1] = block.Children[1], block.Children[0]
+	dst.Finish()
+	treediff.SortUnordered(dst, kinds)
+	edits := treediff.DropUnorderedMoves(treediff.Diff(src, dst), kinds)
+	for _, edit := range edits {
+		if edit.Op == treediff.Move {
+			t.Fatalf("Declaration moved among unordered ones: %s", describe(edits))
+		}
+	}
+	if len(edits) == 0 {
+		t.Fatalf("Modified declaration is unchanged")
+	}
+}
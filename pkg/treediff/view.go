@@ -0,0 +1,181 @@
+package treediff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ViewLine is one line of a folded view of the differences between two
+// trees.  Op is '+' for an inserted subtree, '-' for a deleted one, '~'
+// for an updated label, '>' for a move, '=' for a respelling, and ' ' for
+// unchanged structure.
+type ViewLine struct {
+	Op   byte
+	Text string
+}
+
+// viewer assembles a folded view, knowing which destination nodes changed,
+// which source subtrees were deleted from beneath each destination node,
+// and which destination nodes lie on the path to some change
+type viewer struct {
+	mapping *Mapping
+	changed map[*Node][]Edit
+	deleted map[*Node][]*Node
+	path    map[*Node]bool
+	context int
+	lines   []ViewLine
+}
+
+// View shows the differences between two trees as the destination tree in
+// the manner of difftastic, expanding only the nodes on the paths from the
+// root to each change, and folding unchanged subtrees to one line giving
+// their kind and lines.  The context is the depth of unchanged structure
+// shown beside those paths: none at 0, a folded line per sibling at 1, and
+// that many levels of their children beyond.
+func View(src *Node, dst *Node, edits []Edit, context int) []ViewLine {
+	m := Match(src, dst)
+	v := &viewer{
+		mapping: m,
+		changed: map[*Node][]Edit{},
+		deleted: map[*Node][]*Node{},
+		path:    map[*Node]bool{},
+		context: context,
+	}
+	for _, edit := range edits {
+		anchor := edit.Dst
+		if edit.Op == Delete {
+			if edit.Src.Parent == nil || m.Dst(edit.Src.Parent) == nil {
+				continue
+			}
+			anchor = m.Dst(edit.Src.Parent)
+			v.deleted[anchor] = append(v.deleted[anchor], edit.Src)
+		} else {
+			v.changed[anchor] = append(v.changed[anchor], edit)
+		}
+		for n := anchor; n != nil; n = n.Parent {
+			v.path[n] = true
+		}
+	}
+	v.node(dst, 0)
+	return v.lines
+}
+
+// lines describes where a node was written, as "line N" or "lines N-M"
+func lines(span Span) string {
+	switch {
+	case span.StartLine == 0:
+		return ""
+	case span.EndLine > span.StartLine:
+		return fmt.Sprintf("  lines %d-%d", span.StartLine, span.EndLine)
+	}
+	return fmt.Sprintf("  line %d", span.StartLine)
+}
+
+// rendered writes a whole subtree on one line, preceded by its field
+func rendered(n *Node) string {
+	text := Render(n, contextDepth)
+	if n.Field != "" && n.Field != n.Kind {
+		text = n.Field + "=" + text
+	}
+	return clip(text)
+}
+
+// respelled describes a node by its spelling in the source and destination
+func respelled(src, dst *Node) string {
+	desc := strings.TrimSuffix(dst.String(), "("+dst.Label+")")
+	return desc + fmt.Sprintf("(%s -> %s)", src.Written(), dst.Written())
+}
+
+func (v *viewer) add(op byte, indent int, text string) {
+	v.lines = append(v.lines, ViewLine{Op: op, Text: strings.Repeat("  ", indent) + text})
+}
+
+// node shows a destination node with its changes, expanding it if a change
+// lies beneath, and folding it otherwise
+func (v *viewer) node(n *Node, indent int) {
+	desc := n.String()
+	for _, edit := range v.changed[n] {
+		switch edit.Op {
+		case Insert:
+			v.add('+', indent, rendered(n)+lines(n.Span))
+			return
+		case Update:
+			v.add('~', indent, respelled(edit.Src, n)+lines(n.Span))
+		case Respell:
+			v.add('=', indent, respelled(edit.Src, n)+" respelled"+lines(n.Span))
+		default:
+			v.add('>', indent, fmt.Sprintf("%s moved from line %d%s",
+				desc, edit.Src.Span.StartLine, lines(n.Span)))
+		}
+	}
+	if !v.path[n] {
+		if len(v.changed[n]) == 0 {
+			v.fold(n, indent, v.context)
+		}
+		return
+	}
+	if len(v.changed[n]) == 0 {
+		v.add(' ', indent, desc+lines(n.Span))
+	}
+	// Deleted subtrees are shown where they were among the matched children
+	deleted := v.deleted[n]
+	omitted := 0
+	for _, c := range n.Children {
+		if partner := v.mapping.Src(c); partner != nil {
+			deleted = v.before(deleted, partner, indent+1)
+		}
+		if v.context == 0 && !v.path[c] && len(v.changed[c]) == 0 {
+			omitted++
+			continue
+		}
+		v.node(c, indent+1)
+	}
+	v.before(deleted, nil, indent+1)
+	if omitted > 0 {
+		v.add(' ', indent+1, fmt.Sprintf("... %d unchanged", omitted))
+	}
+}
+
+// before shows the deleted subtrees preceding a source node among its
+// siblings, or all of them given none, returning those remaining
+func (v *viewer) before(deleted []*Node, src *Node, indent int) []*Node {
+	var remaining []*Node
+	for _, d := range deleted {
+		if src != nil && (src.Parent != d.Parent || position(src) < position(d)) {
+			remaining = append(remaining, d)
+			continue
+		}
+		v.add('-', indent, rendered(d)+lines(d.Span)+" (old)")
+	}
+	return remaining
+}
+
+// position gives the index of a node among its siblings
+func position(n *Node) int {
+	for i, c := range n.Parent.Children {
+		if c == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// fold shows an unchanged subtree to the given depth, the last level of it
+// summarized one line per node
+func (v *viewer) fold(n *Node, indent int, depth int) {
+	switch {
+	case depth <= 0:
+		return
+	case depth == 1 || len(n.Children) == 0:
+		if len(n.Children) == 0 {
+			v.add(' ', indent, n.String()+lines(n.Span))
+		} else {
+			v.add(' ', indent, n.String()+" ..."+lines(n.Span))
+		}
+		return
+	}
+	v.add(' ', indent, n.String()+lines(n.Span))
+	for _, c := range n.Children {
+		v.fold(c, indent+1, depth-1)
+	}
+}
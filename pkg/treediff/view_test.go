@@ -0,0 +1,62 @@
+package treediff_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+)
+
+func viewText(view []treediff.ViewLine) string {
+	var lines []string
+	for _, line := range view {
+		lines = append(lines, string(line.Op)+" "+line.Text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestView(t *testing.T) {
+	src, dst := ruleTree(t, "1", "2"), ruleTree(t, "1", "3")
+	edits := treediff.Diff(src, dst)
+
+	// Unchanged siblings of the path to the change are folded to a line
+	text := viewText(treediff.View(src, dst, edits, 1))
+	expected := []string{
+		"  stylesheet  lines 1-3",
+		"~         string_value(2 -> 3)  line 3",
+		"        declaration ...  line 2",
+		"      selectors ...  line 1",
+	}
+	for _, line := range expected {
+		if !strings.Contains(text, line) {
+			t.Fatalf("View lacks %q:\n%s", line, text)
+		}
+	}
+
+	// Without context they are only counted, and with more are expanded
+	text = viewText(treediff.View(src, dst, edits, 0))
+	if strings.Contains(text, "selectors") || !strings.Contains(text, "... 1 unchanged") {
+		t.Fatalf("View shows context:\n%s", text)
+	}
+	text = viewText(treediff.View(src, dst, edits, 2))
+	if !strings.Contains(text, "        tag_name  line 1") {
+		t.Fatalf("View lacks deeper context:\n%s", text)
+	}
+
+	// A deleted subtree is shown where it was
+	dst = ruleTree(t, "1", "2")
+	block := dst.Children[0].Children[1]
+	block.Children = block.Children[1:]
+	dst.Finish()
+	text = viewText(treediff.View(src, dst, treediff.Diff(src, dst), 1))
+	if !strings.Contains(text, "-       declaration(property_name, integer_value(1))  line 2 (old)") {
+		t.Fatalf("View lacks the deletion:\n%s", text)
+	}
+
+	// A respelled literal is shown as written on each side
+	src, dst = literalTree(t, "int_literal", "0x10"), literalTree(t, "int_literal", "16")
+	text = viewText(treediff.View(src, dst, treediff.Diff(src, dst), 1))
+	if !strings.Contains(text, "int_literal(0x10 -> 16) respelled") {
+		t.Fatalf("View lacks the respelling:\n%s", text)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os/exec"
 	"regexp"
+	"strings"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 
@@ -12,33 +13,119 @@ import (
 )
 
 func simplifyParseTree(parseTree string) string {
+	// Spans of nodes are appended when `treesit` is run with SDT_SPANS
+	reSpan := regexp.MustCompile(`(?m)\t@\d+:\d+-\d+:\d+$`)
+	parseTree = reSpan.ReplaceAllString(parseTree, "")
 	reNoLineCol := regexp.MustCompile(`(?m)^.{5} \| `)
 	return reNoLineCol.ReplaceAllString(parseTree, "")
 }
 
-func Diff(
-	filename string,
-	options types.Options,
-	config types.Config,
-) (string, error) {
-	var headTree []byte
-	var currentTree []byte
-	cmd := "treesit"
-	switches := []string{}
+// declName finds the name a definition subtree declares: the shallowest
+// `name:` or `declarator:` field holding an identifier
+func declName(subtree []string) string {
+	reName := regexp.MustCompile(
+		`^( *)(name|declarator): \(\w*(identifier|constant|name) ([^ )]+)\)`)
+	name := ""
+	depth := -1
+	for _, line := range subtree[1:] {
+		m := reName.FindStringSubmatch(line)
+		if m != nil && (depth < 0 || len(m[1]) < depth) {
+			name = m[4]
+			depth = len(m[1])
+		}
+	}
+	return name
+}
 
-	// Check whether `treesit` and `tree-sitter` are available at all
+// Subtree extracts a function, method, class, or similar definition from a
+// simplified parse tree.  Grammars differ in naming such nodes, so any node
+// kind mentioning one of those words is considered.  A dotted symbol such
+// as `Class.method` descends through the enclosing definitions in turn.
+func Subtree(tree string, symbol string) (string, bool) {
+	reDefinition := regexp.MustCompile(
+		`^ *(\w+: )?\(\w*(function|method|class|struct|module|impl|trait|interface|enum)\w*$`)
+	lines := strings.Split(tree, "\n")
+	for _, name := range strings.Split(symbol, ".") {
+		found := false
+		for i := range lines {
+			if !reDefinition.MatchString(lines[i]) {
+				continue
+			}
+			subtree := utils.IndentedSubtree(lines, i, " ")
+			if declName(subtree) == name {
+				lines = subtree
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+// The availability check is remembered, since walking history may ask often
+var checked bool
+var checkErr error
+
+// available checks whether `treesit` and `tree-sitter` can be run at all
+func available() error {
+	if !checked {
+		checked = true
+		checkErr = installed()
+	}
+	return checkErr
+}
+
+func installed() error {
 	installCheck := exec.Command("treesit", "--help")
 	_, err := installCheck.Output()
 	if err != nil {
 		utils.Info("Neither specialized parser nor support utility `treesit` is available")
-		return "", err
+		return err
 	}
 	installCheck = exec.Command("tree-sitter", "--help")
 	_, err = installCheck.Output()
 	if err != nil {
 		utils.Info("Neither specialized parser nor underlying `tree-sitter` CLI is available")
+		return err
+	}
+	return nil
+}
+
+// RawTree returns the parse tree of one file as the parser reports it,
+// with the positions the tree model needs
+func RawTree(filename string, config types.Config) ([]byte, error) {
+	if err := available(); err != nil {
+		return nil, err
+	}
+	return utils.FileTree("treesit", []string{}, filename)
+}
+
+// Tree returns the simplified parse tree that is compared for one file
+func Tree(filename string, config types.Config) (string, error) {
+	tree, err := RawTree(filename, config)
+	if err != nil {
 		return "", err
 	}
+	return simplifyParseTree(string(tree)), nil
+}
+
+func Diff(
+	filename string,
+	options types.Options,
+	config types.Config,
+) (string, types.ChangeKind, error) {
+	var headTree []byte
+	var currentTree []byte
+	cmd := "treesit"
+	switches := []string{}
+
+	// Check whether `treesit` and `tree-sitter` are available at all
+	if err := available(); err != nil {
+		return "", types.Unsupported, err
+	}
 
 	// Generate AST, don't canonicalize
 	if filename == "" {
@@ -52,7 +139,7 @@ func Diff(
 	}
 	// If no trees are produced, tree-sitter does not support this language
 	if len(headTree) == 0 || len(currentTree) == 0 {
-		return "", errors.New("Tree-sitter grammar for language unavailable")
+		return "", types.Unsupported, errors.New("Tree-sitter grammar for language unavailable")
 	}
 
 	// Make the trees into slightly simpler string representation
@@ -64,16 +151,22 @@ func Diff(
 	diffs := dmp.DiffMain(headTreeString, currentTreeString, false)
 
 	if options.Parsetree {
-		return utils.ColorDiff(dmp, diffs,
-			types.Treesit, options.Dumbterm, options.Minimal), nil
+		if view, change := utils.TreeChanges(
+			filename, headTree, currentTree,
+			types.Treesit, options, config); change != types.Unsupported {
+			return view, change, nil
+		}
+		report, change := utils.ColorDiff(dmp, diffs,
+			types.Treesit, options.Dumbterm, options.Minimal)
+		return report, change, nil
 	}
 
 	if options.Semantic {
-		return utils.SemanticChanges(
-			dmp, diffs, filename,
-			headTree, headTreeString,
-			types.Treesit, options.Dumbterm, options.Minimal), nil
+		report, change := utils.SemanticChanges(
+			filename, headTree, currentTree,
+			types.Treesit, options, config)
+		return report, change, nil
 	}
 
-	return "| No diff type specified", nil
+	return "| No diff type specified", types.Unsupported, nil
 }
@@ -124,7 +124,7 @@ func TestNoSemanticDiffJulia(t *testing.T) {
 	if !treeSitterInstalled {
 		return
 	}
-	report, err := treesitter.Diff("", opts, config)
+	report, _, err := treesitter.Diff("", opts, config)
 
 	if extensions.Contains(".jl") {
 		if !strings.Contains(report, "| No semantic differences detected") {
@@ -149,7 +149,7 @@ func TestSemanticDiffJulia(t *testing.T) {
 	if !treeSitterInstalled {
 		return
 	}
-	report, err := treesitter.Diff("", opts, config)
+	report, _, err := treesitter.Diff("", opts, config)
 
 	if extensions.Contains(".jl") {
 		changes := []string{
@@ -195,7 +195,7 @@ func TestNoParseTreeDiffJulia(t *testing.T) {
 	if !treeSitterInstalled {
 		return
 	}
-	report, err := treesitter.Diff("", opts, config)
+	report, _, err := treesitter.Diff("", opts, config)
 
 	if extensions.Contains(".jl") {
 		// Since we are using the opts.Dumbterm, changes would contain
@@ -225,7 +225,7 @@ func TestNoSemanticDiffC(t *testing.T) {
 	if !treeSitterInstalled {
 		return
 	}
-	report, err := treesitter.Diff("", opts, config)
+	report, _, err := treesitter.Diff("", opts, config)
 
 	if extensions.Contains(".c") {
 		if !strings.Contains(report, "| No semantic differences detected") {
@@ -248,7 +248,7 @@ func TestSemanticDiffC(t *testing.T) {
 	if !treeSitterInstalled {
 		return
 	}
-	report, err := treesitter.Diff("", opts, config)
+	report, _, err := treesitter.Diff("", opts, config)
 
 	if extensions.Contains(".c") {
 		changes := []string{
@@ -279,7 +279,7 @@ func TestNoParseTreeDiffC(t *testing.T) {
 	if !treeSitterInstalled {
 		return
 	}
-	report, err := treesitter.Diff("", opts, config)
+	report, _, err := treesitter.Diff("", opts, config)
 
 	if extensions.Contains(".c") {
 		// Since we are using the opts.Dumbterm, changes would contain
@@ -309,7 +309,7 @@ func TestNoSemanticDiffHaskell(t *testing.T) {
 	if !treeSitterInstalled {
 		return
 	}
-	report, err := treesitter.Diff("", opts, config)
+	report, _, err := treesitter.Diff("", opts, config)
 
 	if extensions.Contains(".hs") {
 		if !strings.Contains(report, "| No semantic differences detected") {
@@ -335,7 +335,7 @@ func TestNoParseTreeDiffHaskell(t *testing.T) {
 	if !treeSitterInstalled {
 		return
 	}
-	report, err := treesitter.Diff("", opts, config)
+	report, _, err := treesitter.Diff("", opts, config)
 
 	if extensions.Contains(".hs") {
 		// Since we are using the opts.Dumbterm, changes would contain
@@ -368,7 +368,7 @@ func TestSemanticDiffHaskell(t *testing.T) {
 	if !treeSitterInstalled {
 		return
 	}
-	report, err := treesitter.Diff("", opts, config)
+	report, _, err := treesitter.Diff("", opts, config)
 
 	if extensions.Contains(".hs") {
 		changes := []string{
@@ -387,3 +387,32 @@ func TestSemanticDiffHaskell(t *testing.T) {
 		}
 	}
 }
+
+var cTree = `(translation_unit
+  (function_definition
+    type: (primitive_type)
+    declarator: (function_declarator
+      declarator: (identifier helper)
+      parameters: (parameter_list
+        (parameter_declaration
+          type: (primitive_type)
+          declarator: (identifier main))))
+    body: (compound_statement))
+  (function_definition
+    type: (primitive_type)
+    declarator: (function_declarator
+      declarator: (identifier main)
+      parameters: (parameter_list))
+    body: (compound_statement
+      (return_statement
+        (number_literal 0)))))`
+
+func TestSubtree(t *testing.T) {
+	subtree, found := treesitter.Subtree(cTree, "main")
+	if !found || !strings.Contains(subtree, "(number_literal 0)") {
+		t.Fatalf("Failed to extract function `main`, got:\n%s", subtree)
+	}
+	if !strings.HasPrefix(subtree, "(function_definition") {
+		t.Fatalf("Extracted subtree not dedented:\n%s", subtree)
+	}
+}
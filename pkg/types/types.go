@@ -6,36 +6,148 @@ type (
 		Status      bool
 		Semantic    bool
 		Parsetree   bool
+		RangeDiff   bool
+		Log         bool
+		BlameIgnore bool
+		History     bool
+		Hooks       bool
+		Tree        bool
+		Raw         bool // Print the parser's own output for the tree subcommand
+		JSON        bool // Print the tree model for the tree subcommand
+		Subcommand  string
 		Glob        string
 		Minimal     bool
-		Dumbterm    bool
-		Verbose     bool
-		Source      string
-		Destination string
+		Show        string // Which segments semantic diffs show
+		Sort        string // Order of the segments of semantic diffs
+		Symbols     bool   // Summarize semantic diffs by declaration
+		Docs        string // How changes to comments and docstrings count
+		Explain     bool   // Show the subtrees differing behind each segment
+		WordDiff    bool   // Mark the changed tokens of lines in plain text
+		Alpha       bool   // Disregard consistent renames of locals
+		// Identifiers substituted in the old side's trees, old name to new
+		Renames     map[string]string
+		RulesTest   bool // Report where rewrite rules fired, by segment
+		FirstParent bool
+		Cosmetic    bool // Only show commits without semantic changes
+		Update      bool // Append to existing files rather than print
+		// Allow files lacking an analyzer in formatting-only commits
+		AllowUnsupported bool
+		ContextDepth     int // Levels of structure around parse tree changes
+		Dumbterm         bool
+		Verbose          bool
+		Source           string
+		Destination      string
+		Args             []string // Positional arguments following a subcommand
 	}
 
 	Config struct {
 		Description string             `toml:"description"`
 		Commands    map[string]Command `toml:"commands"`
 		Glob        string             `toml:"glob"`
+		Hooks       HooksConfig        `toml:"hooks"`
+		// Weights of the kinds of risk, by language or "default"
+		Risk map[string]map[string]float64 `toml:"risk"`
+		// Whether the order of declarations is significant, by language
+		Ordered map[string]bool `toml:"ordered"`
+		// Kinds of nodes compared without regard to order, by language
+		Unordered map[string][]string `toml:"unordered"`
+		// Rewrites of equivalent constructs, usually from .sdt-rules.toml
+		Rules []Rule `toml:"rule"`
+	}
+
+	// Rule rewrites trees matching a pattern into another pattern, both
+	// written as S-expressions of the tree model of one language
+	Rule struct {
+		Name     string `toml:"name"`
+		Language string `toml:"language"` // e.g. "python" or "treesit"
+		Match    string `toml:"match"`
+		Replace  string `toml:"replace"`
+	}
+
+	// Policies applied by `sdt hooks run`
+	HooksConfig struct {
+		StylePattern string `toml:"style_pattern"` // Messages claiming style-only
+		StrictPush   bool   `toml:"strict_push"`   // Reject unanalyzable pushes
 	}
 
 	Command struct {
 		Executable string   `toml:"executable"`
 		Switches   []string `toml:"switches"`
 		Options    string   `toml:"options"`
+		Offsets    string   `toml:"offsets"` // Unit of offsets the parser reports
+	}
+
+	// Analyzer bundles the operations that one language package provides.
+	// Operations a language cannot support are left nil.
+	Analyzer struct {
+		Name    string
+		Diff    func(string, Options, Config) (string, ChangeKind)
+		Tree    func(string, Config) (string, error)
+		Subtree func(string, string) (string, bool)
+		RawTree func(string, Config) ([]byte, error)
+		Parse   ParseType // The tree model of RawTree's output
 	}
 
 	Highlights struct {
-		Add     string
-		Del     string
-		Header  string
-		Info    string
-		Clear   string
-		Neutral string
+		Add      string
+		Del      string
+		Header   string
+		Info     string
+		Clear    string
+		Neutral  string
+		Emphasis string // Tokens of a changed line that changed its meaning
+		Dim      string // Tokens of a changed line that changed cosmetically
 	}
 )
 
+// Values of Options.Show: only segments with semantic changes, or every
+// segment labelled with the kind of change
+const (
+	ShowSemantic = "semantic"
+	ShowAll      = "all"
+)
+
+// Values of Options.Docs: changes to comments and docstrings judged as
+// code, reported in a section of their own, or not reported
+const (
+	DocsSemantic = "semantic"
+	DocsSeparate = "separate"
+	DocsHide     = "hide"
+)
+
+// DocsApart tells whether changes to comments and docstrings are kept
+// apart from those to code, whether shown separately or hidden
+func (options Options) DocsApart() bool {
+	return options.Docs == DocsSeparate || options.Docs == DocsHide
+}
+
+// Values of Options.Sort: segments in the order of the diff, or riskiest
+// first
+const (
+	SortDiff = "diff"
+	SortRisk = "risk"
+)
+
+// The report produced by analyzers when normalized trees are equal
+const NoSemanticDiff = "| No semantic differences detected"
+
+// Classification of the change to a single file
+type ChangeKind int8
+
+const (
+	Cosmetic    ChangeKind = iota // Normalized trees are identical
+	Semantic                      // Normalized trees differ
+	Unsupported                   // No analyzer, or the file did not parse
+)
+
+// FileResult is the outcome of analyzing one file of a comparison
+type FileResult struct {
+	Filename string
+	Language string
+	Change   ChangeKind
+	Format   []string // Changes of encoding or line endings, all cosmetic
+}
+
 type LineType int8
 
 const (
@@ -47,12 +159,14 @@ const (
 // In places, github.com/fatih/color is used, but raw ANSI is easier
 // for writing custom reports based on sergi/go-diff/diffmatchpatch
 var Colors Highlights = Highlights{
-	Add:     "\x1b[32m", // green
-	Del:     "\x1b[31m", // red
-	Header:  "\x1b[33m", // yellow
-	Info:    "\x1b[36m", // cyan
-	Clear:   "\x1b[0m",
-	Neutral: "",
+	Add:      "\x1b[32m", // green
+	Del:      "\x1b[31m", // red
+	Header:   "\x1b[33m", // yellow
+	Info:     "\x1b[36m", // cyan
+	Clear:    "\x1b[0m",
+	Neutral:  "",
+	Emphasis: "\x1b[1;4m", // bold, underlined
+	Dim:      "\x1b[2m",
 }
 
 var Dumbterm Highlights = Highlights{
@@ -73,6 +187,81 @@ var PlainASCII Highlights = Highlights{
 	Neutral: "",
 }
 
+// Units in which a parser may report offsets into its source.  Acorn, for
+// example, counts the UTF-16 code units of a JavaScript string.
+const (
+	ByteOffsets  = "bytes"
+	RuneOffsets  = "runes"
+	UTF16Offsets = "utf16"
+)
+
+// Kinds of risk a semantic change may carry, by the nodes it touches
+const (
+	RiskControl   = "control"   // Branches, loops, and exceptions
+	RiskCondition = "condition" // Within the test of a branch or loop
+	RiskReturn    = "return"    // Within a returned or yielded value
+	RiskCall      = "call"      // Function or method calls
+	RiskLiteral   = "literal"   // Literal values
+	RiskOther     = "other"     // Anything else, e.g. an assignment
+)
+
+// Default weights of each kind of risk, which `[risk.default]` and, e.g.,
+// `[risk.python]` in the configuration override
+var RiskWeights = map[string]float64{
+	RiskControl:   5,
+	RiskCondition: 5,
+	RiskReturn:    4,
+	RiskCall:      3,
+	RiskLiteral:   1,
+	RiskOther:     2,
+}
+
+// Weights gives the weights of risk for a language, as configured
+func (config Config) Weights(language string) map[string]float64 {
+	weights := map[string]float64{}
+	for _, table := range []map[string]float64{
+		RiskWeights, config.Risk["default"], config.Risk[language]} {
+		for kind, weight := range table {
+			weights[kind] = weight
+		}
+	}
+	return weights
+}
+
+// Default significance of the order of declarations, which `[ordered]` in
+// the configuration overrides, e.g. `python = true`.  The "decorated" key
+// covers Python definitions with decorators, which often register them.
+var OrderedDeclarations = map[string]bool{
+	"decorated": true,
+}
+
+// OrderMatters tells whether moving declarations changes their meaning in
+// a language (or for the "decorated" key)
+func (config Config) OrderMatters(key string) bool {
+	if ordered, found := config.Ordered[key]; found {
+		return ordered
+	}
+	return OrderedDeclarations[key]
+}
+
+// Default kinds of nodes, by language, whose order among their siblings
+// has no meaning, which `[unordered]` in the configuration extends.  An
+// entry is a kind, e.g. "ImportSpec", or a kind of parent and the kind or
+// field of its children, e.g. "Set.elts".  For SQL, "IN" covers the values
+// listed by the IN operator.
+var UnorderedKinds = map[string][]string{
+	"go":      {"ImportSpec", "KeyValueExpr"},
+	"python":  {"Set.elts"},
+	"treesit": {"block.declaration"}, // CSS
+	"sql":     {"IN"},
+}
+
+// UnorderedIn lists the kinds of nodes compared as multisets in a language
+func (config Config) UnorderedIn(language string) []string {
+	kinds := append([]string{}, UnorderedKinds[language]...)
+	return append(kinds, config.Unordered[language]...)
+}
+
 // Create "enum" of filetypes we can handle (<=256 langs for now)
 type ParseType uint8
 
@@ -120,6 +309,7 @@ var Commands = map[string]Command{
 		Executable: "node",
 		Switches:   []string{"-e", JsSwitches},
 		Options:    `{sourceType: "module", ecmaVersion: "latest"}`,
+		Offsets:    UTF16Offsets,
 	},
 	// A tiny and simple tool (within this project is  used by default.
 	// For an example of using external tool `jq`, see `samples/.sdt.toml`
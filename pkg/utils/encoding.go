@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings that are recognized in source files
+const (
+	UTF8    = "UTF-8"
+	UTF16LE = "UTF-16LE"
+	UTF16BE = "UTF-16BE"
+	Latin1  = "Latin-1"
+)
+
+// Line-ending styles; a file without any line break has no style
+const (
+	LF    = "LF"
+	CRLF  = "CRLF"
+	Mixed = "mixed"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// TextFormat records how the text of a source file is stored
+type TextFormat struct {
+	Encoding   string
+	BOM        bool
+	LineEnding string
+}
+
+// Plain is true of UTF-8 without a byte order mark and with LF line
+// endings, which is what parsers are given
+func (f TextFormat) Plain() bool {
+	return f.Encoding == UTF8 && !f.BOM && (f.LineEnding == LF || f.LineEnding == "")
+}
+
+// EncodingName describes the encoding, including any byte order mark
+func (f TextFormat) EncodingName() string {
+	if f.BOM {
+		return f.Encoding + " with BOM"
+	}
+	return f.Encoding
+}
+
+// Changes describes the differences in storage between two versions of a
+// file.  These are cosmetic, since the normalized texts are what is parsed.
+func (f TextFormat) Changes(to TextFormat) []string {
+	var changes []string
+	if f.EncodingName() != to.EncodingName() {
+		changes = append(changes,
+			"Encoding changed ("+f.EncodingName()+" to "+to.EncodingName()+")")
+	}
+	// A line ending added to a single line file is not a change of style
+	if f.LineEnding != to.LineEnding && f.LineEnding != "" && to.LineEnding != "" {
+		changes = append(changes,
+			"Line endings changed ("+f.LineEnding+" to "+to.LineEnding+")")
+	}
+	return changes
+}
+
+// utf16Order guesses the byte order of UTF-16 text lacking a byte order
+// mark from where NULs fall, since mostly ASCII text has a NUL in every
+// code unit.  An empty result means the text does not look like UTF-16.
+func utf16Order(text []byte) string {
+	sample := text[:Min(len(text), 1024)]
+	if len(sample) < 2 || len(text)%2 != 0 {
+		return ""
+	}
+	var evenNul, oddNul int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenNul++
+		} else {
+			oddNul++
+		}
+	}
+	units := len(sample) / 2
+	switch {
+	case evenNul == 0 && oddNul*2 > units:
+		return UTF16LE
+	case oddNul == 0 && evenNul*2 > units:
+		return UTF16BE
+	}
+	return ""
+}
+
+// decodeUTF16 converts UTF-16 text in either byte order to UTF-8
+func decodeUTF16(text []byte, encoding string) []byte {
+	units := make([]uint16, len(text)/2)
+	for i := range units {
+		if encoding == UTF16LE {
+			units[i] = uint16(text[2*i]) | uint16(text[2*i+1])<<8
+		} else {
+			units[i] = uint16(text[2*i])<<8 | uint16(text[2*i+1])
+		}
+	}
+	var buff bytes.Buffer
+	for _, r := range utf16.Decode(units) {
+		buff.WriteRune(r)
+	}
+	return buff.Bytes()
+}
+
+// decodeLatin1 converts Latin-1 text, whose bytes are code points, to UTF-8
+func decodeLatin1(text []byte) []byte {
+	var buff bytes.Buffer
+	for _, b := range text {
+		buff.WriteRune(rune(b))
+	}
+	return buff.Bytes()
+}
+
+// lineEnding judges the style of line breaks in UTF-8 text.  A lone CR is
+// not counted as a line break, as neither `git diff` nor parsers treat it
+// as one.
+func lineEnding(text []byte) string {
+	crlf := bytes.Count(text, []byte("\r\n"))
+	lf := bytes.Count(text, []byte("\n")) - crlf
+	switch {
+	case crlf == 0 && lf == 0:
+		return ""
+	case crlf == 0:
+		return LF
+	case lf == 0:
+		return CRLF
+	}
+	return Mixed
+}
+
+// Normalize converts source text to UTF-8 without a byte order mark and
+// with LF line endings, and reports the format the text was stored in.
+// Text that is neither UTF-8 nor UTF-16 is taken to be Latin-1.  Lines are
+// neither joined nor split, so line numbers agree with the original text.
+func Normalize(text []byte) ([]byte, TextFormat) {
+	format := TextFormat{Encoding: UTF8}
+	switch {
+	case bytes.HasPrefix(text, bomUTF8):
+		format.BOM = true
+		text = text[len(bomUTF8):]
+	case bytes.HasPrefix(text, bomUTF16LE):
+		format = TextFormat{Encoding: UTF16LE, BOM: true}
+		text = decodeUTF16(text[len(bomUTF16LE):], UTF16LE)
+	case bytes.HasPrefix(text, bomUTF16BE):
+		format = TextFormat{Encoding: UTF16BE, BOM: true}
+		text = decodeUTF16(text[len(bomUTF16BE):], UTF16BE)
+	default:
+		if encoding := utf16Order(text); encoding != "" {
+			format.Encoding = encoding
+			text = decodeUTF16(text, encoding)
+		} else if !utf8.Valid(text) {
+			format.Encoding = Latin1
+			text = decodeLatin1(text)
+		}
+	}
+
+	format.LineEnding = lineEnding(text)
+	if format.LineEnding == CRLF || format.LineEnding == Mixed {
+		text = bytes.ReplaceAll(text, []byte("\r\n"), []byte("\n"))
+	}
+	return text, format
+}
+
+// normalizedFile gives the name of a file holding the normalized text of a
+// file, which is the file itself when it is already plain.  The function
+// returned removes any temporary file.  An unreadable file is left for the
+// parser to complain about.
+func normalizedFile(filename string) (string, func()) {
+	text, err := os.ReadFile(filename)
+	if err != nil {
+		return filename, func() {}
+	}
+	normal, format := Normalize(text)
+	if format.Plain() {
+		return filename, func() {}
+	}
+
+	// Tools such as tree-sitter select a grammar by extension, so keep it
+	tmpfile, err := os.CreateTemp("", "*-"+filepath.Base(filename))
+	if err != nil {
+		Fail("Could not create a temporary file for %s", filename)
+	}
+	defer tmpfile.Close()
+	tmpfile.Write(normal)
+	return tmpfile.Name(), func() { os.Remove(tmpfile.Name()) }
+}
@@ -0,0 +1,49 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/utils"
+)
+
+func TestNormalize(t *testing.T) {
+	plain := "x = 'é'\ny = 2\n"
+	cases := []struct {
+		text   string
+		format utils.TextFormat
+	}{
+		{plain, utils.TextFormat{Encoding: utils.UTF8, LineEnding: utils.LF}},
+		{"\xEF\xBB\xBFx = 'é'\r\ny = 2\r\n",
+			utils.TextFormat{Encoding: utils.UTF8, BOM: true, LineEnding: utils.CRLF}},
+		{"x = '\xE9'\ny = 2\r\n",
+			utils.TextFormat{Encoding: utils.Latin1, LineEnding: utils.Mixed}},
+		{"\xFF\xFEx\x00 \x00=\x00 \x00'\x00\xE9\x00'\x00\n\x00y\x00 \x00=\x00 \x002\x00\n\x00",
+			utils.TextFormat{Encoding: utils.UTF16LE, BOM: true, LineEnding: utils.LF}},
+		{"\x00x\x00 \x00=\x00 \x00'\x00\xE9\x00'\x00\n\x00y\x00 \x00=\x00 \x002\x00\n",
+			utils.TextFormat{Encoding: utils.UTF16BE, LineEnding: utils.LF}},
+	}
+	for _, c := range cases {
+		text, format := utils.Normalize([]byte(c.text))
+		if string(text) != plain {
+			t.Fatalf("Normalize(%q) gave %q", c.text, text)
+		}
+		if format != c.format {
+			t.Fatalf("Normalize(%q) detected %+v rather than %+v",
+				c.text, format, c.format)
+		}
+	}
+}
+
+func TestFormatChanges(t *testing.T) {
+	dos := utils.TextFormat{Encoding: utils.UTF8, BOM: true, LineEnding: utils.CRLF}
+	unix := utils.TextFormat{Encoding: utils.UTF8, LineEnding: utils.LF}
+	changes := dos.Changes(unix)
+	if len(changes) != 2 ||
+		changes[0] != "Encoding changed (UTF-8 with BOM to UTF-8)" ||
+		changes[1] != "Line endings changed (CRLF to LF)" {
+		t.Fatalf("Wrong changes %q", changes)
+	}
+	if len(unix.Changes(unix)) != 0 {
+		t.Fatalf("Unchanged format reported as %q", unix.Changes(unix))
+	}
+}
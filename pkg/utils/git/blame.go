@@ -0,0 +1,128 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+	"github.com/atlantistechnology/sdt/pkg/utils"
+)
+
+// The file consulted by `git blame` when blame.ignoreRevsFile is set to it
+const IgnoreRevsFile = ".git-blame-ignore-revs"
+
+// IgnoredRevs collects the commit hashes already listed in the body of a
+// .git-blame-ignore-revs file, skipping comments and blank lines
+func IgnoredRevs(body string) map[string]bool {
+	revs := map[string]bool{}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		revs[strings.Fields(line)[0]] = true
+	}
+	return revs
+}
+
+// FormatIgnoreRevs renders commits in the .git-blame-ignore-revs format,
+// with the subject as a comment line above each, omitting those already
+// present in the existing file body
+func FormatIgnoreRevs(commits []Commit, existing string) string {
+	known := IgnoredRevs(existing)
+	var buff strings.Builder
+	for _, commit := range commits {
+		if known[commit.Hash] {
+			continue
+		}
+		buff.WriteString("# " + commit.Subject + "\n")
+		buff.WriteString(commit.Hash + "\n")
+	}
+	return buff.String()
+}
+
+// CosmeticCommits finds those commits of a range whose changes are entirely
+// cosmetic under the configured analyzers, oldest first.  The glob pattern
+// selects the commits changing some matching file, but each is judged by
+// all of the files it changes.  Commits touching files without an analyzer
+// are excluded unless options.AllowUnsupported is set.
+func CosmeticCommits(
+	revRange string,
+	options types.Options,
+	config types.Config,
+) ([]Commit, error) {
+	commits, err := LogCommits(revRange, options.FirstParent)
+	if err != nil {
+		return nil, err
+	}
+
+	var cosmetic []Commit
+	for i := len(commits) - 1; i >= 0; i-- {
+		results, _, err := CommitResults(commits[i].Hash, options, config)
+		if err != nil {
+			return nil, err
+		}
+		if CountChanges(results, options.Glob) == (ChangeCounts{}) {
+			continue
+		}
+		counts := CountChanges(results, "*")
+		if !counts.CosmeticOnly(options.AllowUnsupported) {
+			continue
+		}
+		cosmetic = append(cosmetic, commits[i])
+	}
+	return cosmetic, nil
+}
+
+// BlameIgnoreRevs prints the formatting-only commits of a range in the
+// .git-blame-ignore-revs format, or with update appends the new ones to
+// that file at the top of the working tree
+func BlameIgnoreRevs(
+	revRange string,
+	options types.Options,
+	config types.Config,
+) error {
+	commits, err := CosmeticCommits(revRange, options, config)
+	if err != nil {
+		return err
+	}
+
+	if !options.Update {
+		fmt.Print(FormatIgnoreRevs(commits, ""))
+		return nil
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.New("Unable to locate top of the git working tree")
+	}
+	path := filepath.Join(strings.TrimSpace(string(out)), IgnoreRevsFile)
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("Unable to read " + path)
+	}
+	entries := FormatIgnoreRevs(commits, string(existing))
+	if entries == "" {
+		utils.Info("No new formatting-only commits for %s", path)
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.New("Unable to write " + path)
+	}
+	defer file.Close()
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		file.WriteString("\n")
+	}
+	file.WriteString(entries)
+	utils.Info("Appended %d commits to %s",
+		strings.Count(entries, "\n")/2, path)
+	return nil
+}
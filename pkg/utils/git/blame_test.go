@@ -0,0 +1,37 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/utils/git"
+)
+
+var existingRevs = `# Reformat with black
+1111111111111111111111111111111111111111
+
+# Reindent SQL
+2222222222222222222222222222222222222222
+`
+
+var cosmeticCommits = []git.Commit{
+	{Hash: "2222222222222222222222222222222222222222", Subject: "Reindent SQL"},
+	{Hash: "3333333333333333333333333333333333333333", Subject: "style: gofmt"},
+}
+
+func TestIgnoredRevs(t *testing.T) {
+	revs := git.IgnoredRevs(existingRevs)
+	if len(revs) != 2 {
+		t.Fatalf("IgnoredRevs() found %d revisions rather than 2", len(revs))
+	}
+	if !revs["1111111111111111111111111111111111111111"] {
+		t.Fatalf("IgnoredRevs() failed to find listed revision")
+	}
+}
+
+func TestFormatIgnoreRevs(t *testing.T) {
+	want := "# style: gofmt\n3333333333333333333333333333333333333333\n"
+	entries := git.FormatIgnoreRevs(cosmeticCommits, existingRevs)
+	if entries != want {
+		t.Fatalf("FormatIgnoreRevs() produced %q rather than %q", entries, want)
+	}
+}
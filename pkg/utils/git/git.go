@@ -20,6 +20,7 @@ import (
 	"github.com/atlantistechnology/sdt/pkg/python"
 	"github.com/atlantistechnology/sdt/pkg/ruby"
 	"github.com/atlantistechnology/sdt/pkg/sql"
+	"github.com/atlantistechnology/sdt/pkg/treediff"
 	"github.com/atlantistechnology/sdt/pkg/treesitter"
 	"github.com/atlantistechnology/sdt/pkg/types"
 	"github.com/atlantistechnology/sdt/pkg/utils"
@@ -52,55 +53,118 @@ var jsonExt = mapset.New(
 // V Programming language is 80% similar to Go; parser "probably" works
 var goExt = mapset.New(".go", ".v")
 
-func FileComparer(ext string) (
-	func(string, types.Options, types.Config) string,
-	string,
-	error,
-) {
+// FileAnalyzer selects the language support for a file extension
+func FileAnalyzer(ext string) (types.Analyzer, error) {
 	ext = strings.ToLower(ext)
 
 	if rubyExt.Contains(ext) {
-		return ruby.Diff, "Ruby", nil
+		return types.Analyzer{Name: "Ruby",
+			Diff: ruby.Diff, Tree: ruby.Tree, Subtree: ruby.Subtree,
+			RawTree: ruby.RawTree, Parse: types.Ruby}, nil
 	}
 	if pyExt.Contains(ext) {
-		return python.Diff, "Python", nil
+		return types.Analyzer{Name: "Python",
+			Diff: python.Diff, Tree: python.Tree, Subtree: python.Subtree,
+			RawTree: python.RawTree, Parse: types.Python}, nil
 	}
 	if sqlExt.Contains(ext) {
-		return sql.Diff, "SQL", nil
+		return types.Analyzer{Name: "SQL",
+			Diff: sql.Diff, Tree: sql.Tree, Parse: types.SomeOtherLanguage}, nil
 	}
 	if jsExt.Contains(ext) {
-		return javascript.Diff, "JavaScript", nil
+		return types.Analyzer{Name: "JavaScript",
+			Diff: javascript.Diff, Tree: javascript.Tree,
+			Subtree: javascript.Subtree, RawTree: javascript.RawTree,
+			Parse: types.JavaScript}, nil
 	}
 	if jsonExt.Contains(ext) {
-		return json_canonical.Diff, "JSON", nil
+		return types.Analyzer{Name: "JSON",
+			Diff: json_canonical.Diff, Tree: json_canonical.Tree,
+			Parse: types.JSON}, nil
 	}
 	if goExt.Contains(ext) {
-		return golang.Diff, "Go", nil
+		return types.Analyzer{Name: "Go",
+			Diff: golang.Diff, Tree: golang.Tree, Subtree: golang.Subtree,
+			RawTree: golang.RawTree, Parse: types.Go}, nil
 	}
-	// No built-in differ is available, but tree-sitter might be
-	return nil, "Tree-sitter?",
-		errors.New("No built-in differ for extension" + ext)
+	// No built-in analyzer is available, but tree-sitter might be.  Its
+	// Diff differs in signature, so is called directly in analyzeFile
+	return types.Analyzer{Name: "Tree-sitter?",
+			Tree: treesitter.Tree, Subtree: treesitter.Subtree,
+			RawTree: treesitter.RawTree, Parse: types.Treesit},
+		errors.New("No built-in analyzer for extension" + ext)
 }
 
-func CompareFileType(
+func FileComparer(ext string) (
+	func(string, types.Options, types.Config) (string, types.ChangeKind),
+	string,
+	error,
+) {
+	analyzer, err := FileAnalyzer(ext)
+	return analyzer.Diff, analyzer.Name, err
+}
+
+// FileTreer is the counterpart of FileComparer that produces the normalized
+// tree (or canonical form) for a single file rather than a report
+func FileTreer(ext string) (
+	func(string, types.Config) (string, error),
+	string,
+	error,
+) {
+	analyzer, err := FileAnalyzer(ext)
+	return analyzer.Tree, analyzer.Name, err
+}
+
+// analyzeFile compares the versions of one file with the analyzer for its
+// extension, or with tree-sitter lacking one, giving the report and the
+// result it judged.  Changes of encoding or line endings are invisible to
+// the analyzers, which are given normalized text, so are found apart.
+func analyzeFile(
 	ext string,
 	filename string,
 	options types.Options,
 	config types.Config,
-) {
-	diffColor := color.New(color.FgYellow)
-	differ, _, err := FileComparer(ext)
+) (types.FileResult, string) {
+	analyzer, err := FileAnalyzer(ext)
+	result := types.FileResult{Filename: filename, Language: analyzer.Name}
+	result.Format = utils.FormatChanges(filename, options)
+	if options.RulesTest && err == nil && !treediff.Supported(analyzer.Parse) {
+		result.Change = types.Unsupported
+		return result, "| Rewrite rules apply only to languages with a tree model"
+	}
 	if err == nil {
-		diffColor.Println(differ(filename, options, config))
-	} else {
-		// Before giving up on fully custom parsers, try `treesit`
-		results, err2 := treesitter.Diff(filename, options, config)
-		if err2 != nil {
-			diffColor.Println("| No available semantic analyzer for this format")
-		} else {
-			diffColor.Println(results)
+		report, change := analyzer.Diff(filename, options, config)
+		result.Change = change
+		if options.Docs == types.DocsSeparate && !treediff.Supported(analyzer.Parse) {
+			report = "| Comments and docstrings are reported apart only for " +
+				"languages with a tree model\n" + report
 		}
+		return result, report
+	}
+	// Before giving up on fully custom parsers, try `treesit`
+	report, change, err := treesitter.Diff(filename, options, config)
+	if err != nil {
+		result.Change = types.Unsupported
+		return result, "| No available semantic analyzer for this format"
 	}
+	result.Language = "Tree-sitter"
+	result.Change = change
+	return result, report
+}
+
+func CompareFileType(
+	ext string,
+	filename string,
+	options types.Options,
+	config types.Config,
+) types.FileResult {
+	diffColor := color.New(color.FgYellow)
+	result, report := analyzeFile(ext, filename, options, config)
+	for _, change := range result.Format {
+		diffColor.Println("| " + change)
+	}
+	diffColor.Println(report)
+	return result
 }
 
 func Compare(
@@ -108,7 +172,8 @@ func Compare(
 	options types.Options,
 	config types.Config,
 	lineType types.LineType,
-) {
+) []types.FileResult {
+	var results []types.FileResult
 	switch lineType {
 	case types.Status:
 		info := strings.TrimSpace(line)
@@ -118,7 +183,8 @@ func Compare(
 		ext := filepath.Ext(line)
 
 		if status == "modified" {
-			CompareFileType(ext, filename, options, config)
+			results = append(results,
+				CompareFileType(ext, filename, options, config))
 		}
 	case types.RawNames:
 		ext := filepath.Ext(options.Source)
@@ -131,11 +197,33 @@ func Compare(
 		// We allow a slight cleverness of an empty filename meaning that
 		// the comparison is between options.Source and options.Destination
 		// which will by filepaths not branches/revisions
-		CompareFileType(ext, "", options, config)
+		result := CompareFileType(ext, "", options, config)
+		result.Filename = options.Destination
+		results = append(results, result)
+	}
+	return results
+}
+
+var reRenamedPart = regexp.MustCompile(`^(.*)\{(.*) => (.*)\}(.*)$`)
+
+// renamedPaths gives the old and new paths of a renamed file, as `git diff
+// --compact-summary` shows them, e.g. "a.py => b.py" or "pkg/{a => b}.py"
+func renamedPaths(line string) []string {
+	line = strings.TrimSpace(line)
+	if parts := reRenamedPart.FindStringSubmatch(line); parts != nil {
+		return []string{
+			strings.ReplaceAll(parts[1]+parts[2]+parts[4], "//", "/"),
+			strings.ReplaceAll(parts[1]+parts[3]+parts[4], "//", "/"),
+		}
 	}
+	return strings.SplitN(line, " => ", 2)
 }
 
-func ParseGitDiffCompact(diff string, options types.Options, config types.Config) {
+func ParseGitDiffCompact(
+	diff string,
+	options types.Options,
+	config types.Config,
+) []types.FileResult {
 	// We wish to sort the changes by their type. The display is a hybrid
 	// between `git diff` and `git status`.  Untracked files won't be shown.
 	// But for empty destination, the on-disk files will be used as target
@@ -147,15 +235,17 @@ func ParseGitDiffCompact(diff string, options types.Options, config types.Config
 	moveFile := color.New(color.FgMagenta)
 	changeFile := color.New(color.FgCyan)
 	var changed, added, gone, moved []string
+	var paths []string // Of files changed, added, or removed
+	var results []types.FileResult
 
 	if len(lines) <= 1 {
 		header.Println("No changes detected")
-		os.Exit(0)
+		return results
 	} else if options.Status {
 		utils.Info("git diff --compact-summary %s %s",
 			options.Source, options.Destination)
 		fmt.Println(diff)
-		os.Exit(0)
+		return results
 	}
 
 	lines = lines[:len(lines)-2] // Do not use summary final line
@@ -171,7 +261,12 @@ func ParseGitDiffCompact(diff string, options types.Options, config types.Config
 		filename := strings.Split(line, " ")[1]
 		if !pat.Match(filename) {
 			continue
-		} else if reStripNew.MatchString(line) {
+		} else if reMoved.MatchString(line) {
+			paths = append(paths, renamedPaths(line)...)
+		} else {
+			paths = append(paths, filename)
+		}
+		if reStripNew.MatchString(line) {
 			added = append(added, "   "+reStripNew.ReplaceAllString(line, ""))
 		} else if reStripGone.MatchString(line) {
 			gone = append(gone, "   "+reStripGone.ReplaceAllString(line, ""))
@@ -202,6 +297,7 @@ func ParseGitDiffCompact(diff string, options types.Options, config types.Config
 	for _, filename := range moved {
 		moveFile.Println(filename)
 	}
+	reportCrossFileMoves(paths, options, config)
 
 	if len(changed) > 0 {
 		if options.Destination != "" {
@@ -231,6 +327,8 @@ func ParseGitDiffCompact(diff string, options types.Options, config types.Config
 			body, err = cmdHead.Output()
 			if err != nil {
 				changeFile.Println("    " + filename)
+				results = append(results, types.FileResult{
+					Filename: filename, Change: types.Unsupported})
 				continue
 			}
 			tmpfile.Write(body)
@@ -249,6 +347,8 @@ func ParseGitDiffCompact(diff string, options types.Options, config types.Config
 			body, err = cmdHead.Output()
 			if err != nil {
 				changeFile.Println("    " + filename)
+				results = append(results, types.FileResult{
+					Filename: filename, Change: types.Unsupported})
 				continue
 			}
 			tmpfile.Write(body)
@@ -257,23 +357,42 @@ func ParseGitDiffCompact(diff string, options types.Options, config types.Config
 		}
 
 		perFileOpts := types.Options{
-			Status:      options.Status,
-			Semantic:    options.Semantic,
-			Parsetree:   options.Parsetree,
-			Glob:        options.Glob,
-			Minimal:     options.Minimal,
-			Verbose:     options.Verbose,
-			Dumbterm:    options.Dumbterm,
-			Source:      src,
-			Destination: dst,
+			Status:       options.Status,
+			Semantic:     options.Semantic,
+			Parsetree:    options.Parsetree,
+			Glob:         options.Glob,
+			Minimal:      options.Minimal,
+			Show:         options.Show,
+			Sort:         options.Sort,
+			Symbols:      options.Symbols,
+			Alpha:        options.Alpha,
+			Docs:         options.Docs,
+			Explain:      options.Explain,
+			WordDiff:     options.WordDiff,
+			ContextDepth: options.ContextDepth,
+			Renames:      options.Renames,
+			RulesTest:    options.RulesTest,
+			Verbose:      options.Verbose,
+			Dumbterm:     options.Dumbterm,
+			Source:       src,
+			Destination:  dst,
 		}
 		changeFile.Println("    " + filename)
-		Compare("", perFileOpts, config, types.RawNames)
+		for _, result := range Compare("", perFileOpts, config, types.RawNames) {
+			result.Filename = filename
+			results = append(results, result)
+		}
 	}
+	return results
 }
 
-func ParseGitStatus(status []byte, options types.Options, config types.Config) {
+func ParseGitStatus(
+	status []byte,
+	options types.Options,
+	config types.Config,
+) []types.FileResult {
 	var section gitStatus = Preamble
+	var results []types.FileResult
 	lines := bytes.Split(status, []byte("\n"))
 
 	header := color.New(color.FgWhite, color.Bold)
@@ -282,6 +401,8 @@ func ParseGitStatus(status []byte, options types.Options, config types.Config) {
 	untracked := color.New(color.FgCyan)
 	pat := glob.MustCompile(options.Glob)
 	reFname := regexp.MustCompile(`^.*:? +`)
+	reNewOrGone := regexp.MustCompile(`^\t(new file|deleted):`)
+	var paths []string // Of files changed, added, or removed
 
 	for i := 0; i < len(lines); i++ {
 		line := string(lines[i])
@@ -303,20 +424,32 @@ func ParseGitStatus(status []byte, options types.Options, config types.Config) {
 				continue
 			}
 
+			if section == Untracked || reNewOrGone.MatchString(line) ||
+				strings.HasPrefix(line, "\tmodified:") {
+				paths = append(paths, strings.TrimSpace(filename))
+			} else if strings.HasPrefix(line, "\trenamed:") {
+				renamed := strings.TrimPrefix(strings.TrimSpace(line), "renamed:")
+				paths = append(paths, strings.SplitN(
+					strings.TrimSpace(renamed), " -> ", 2)...)
+			}
 			switch section {
 			case Staged:
 				staged.Println(fstatus)
 				if options.Semantic || options.Parsetree {
-					Compare(line, options, config, types.Status)
+					results = append(results,
+						Compare(line, options, config, types.Status)...)
 				}
 			case Unstaged:
 				unstaged.Println(fstatus)
 				if options.Semantic || options.Parsetree {
-					Compare(line, options, config, types.Status)
+					results = append(results,
+						Compare(line, options, config, types.Status)...)
 				}
 			case Untracked:
 				untracked.Println(fstatus)
 			}
 		}
 	}
+	reportCrossFileMoves(paths, options, config)
+	return results
 }
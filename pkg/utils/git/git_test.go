@@ -31,7 +31,7 @@ var config = types.Config{
 	Commands:    types.Commands,
 }
 
-func ExampleOutput() {
+func Example_output() {
 	fmt.Fprintf(os.Stdout, "foo")
 	// Output: foo
 }
@@ -0,0 +1,127 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// Revision is a commit together with the name a file had at that commit
+type Revision struct {
+	Commit
+	Path string
+}
+
+// ParseFileHistory reads the output of `git log --name-only` using the
+// format `%x01%H%x09%s`, returning revisions oldest first
+func ParseFileHistory(out string) []Revision {
+	var revisions []Revision
+	for _, entry := range strings.Split(out, "\x01") {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		parts := strings.SplitN(lines[0], "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		revision := Revision{Commit: Commit{Hash: parts[0], Subject: parts[1]}}
+		for _, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line != "" {
+				revision.Path = line
+			}
+		}
+		if revision.Path != "" {
+			revisions = append([]Revision{revision}, revisions...)
+		}
+	}
+	return revisions
+}
+
+// FileHistory lists the commits touching a path, following renames
+func FileHistory(path string) ([]Revision, error) {
+	cmd := exec.Command("git", "log", "--follow", "--format=%x01%H%x09%s",
+		"--name-only", "--", path)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("Unable to read history of " + path)
+	}
+	return ParseFileHistory(string(out)), nil
+}
+
+// SymbolHistory walks the history of a file and lists those commits where
+// the normalized subtree of a named function, method, or class changed
+func SymbolHistory(
+	path string,
+	symbol string,
+	options types.Options,
+	config types.Config,
+) error {
+	analyzer, _ := FileAnalyzer(filepath.Ext(path))
+	if analyzer.Subtree == nil {
+		return errors.New("Symbols cannot be located in " + analyzer.Name + " files")
+	}
+	revisions, err := FileHistory(path)
+	if err != nil {
+		return err
+	}
+
+	header := color.New(color.FgWhite, color.Bold)
+	added := color.New(color.FgGreen)
+	removed := color.New(color.FgRed)
+	modified := color.New(color.FgCyan)
+
+	var lines []string
+	var styles []*color.Color
+	var previous string
+	present := false
+	for _, revision := range revisions {
+		tree, ok, err := TreeAtRevision(revision.Hash, revision.Path, config)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// The file does not parse at this revision
+			continue
+		}
+
+		subtree, found := analyzer.Subtree(tree, symbol)
+		var style *color.Color
+		var change string
+		switch {
+		case found && !present:
+			change, style = "added", added
+		case !found && present:
+			change, style = "removed", removed
+		case found && subtree != previous:
+			change, style = "modified", modified
+		default:
+			continue
+		}
+		present = found
+		previous = subtree
+		lines = append(lines, describeRevision(revision, path, change))
+		styles = append(styles, style)
+	}
+
+	if len(lines) == 0 {
+		header.Printf("No definition of %s found in history of %s\n", symbol, path)
+		return nil
+	}
+	header.Printf("Semantic history of %s in %s:\n", symbol, path)
+	for i := len(lines) - 1; i >= 0; i-- {
+		styles[i].Println(lines[i])
+	}
+	return nil
+}
+
+func describeRevision(revision Revision, path string, change string) string {
+	line := fmt.Sprintf("%.7s  %-8s  %s", revision.Hash, change, revision.Subject)
+	if revision.Path != path {
+		line += "  (as " + revision.Path + ")"
+	}
+	return line
+}
@@ -0,0 +1,271 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/gobwas/glob"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+	"github.com/atlantistechnology/sdt/pkg/utils"
+)
+
+// The hooks `sdt hooks install` manages
+var HookNames = []string{"pre-commit", "commit-msg", "pre-push"}
+
+// Commit messages matching this claim to make only cosmetic changes,
+// unless `style_pattern` is configured in the [hooks] section of .sdt.toml
+const DefaultStylePattern = `(?i)\b(style|fmt|format(ting)?|reformat(ted)?|lint|whitespace)\b`
+
+// Marks a hook script as ours, so reinstalling does not chain to itself
+const hookMarker = "# Installed by sdt (Semantic Diff Tool)"
+
+// Suffix given to a pre-existing hook that our hook then runs first
+const chainedSuffix = ".sdt-chained"
+
+// An all-zero object name marks a ref being created or deleted by a push
+const zeroHash = "0000000000000000000000000000000000000000"
+
+// HookScript is the shell script installed for a hook.  Any hook present
+// before installation is run first, and a failure there is respected.
+func HookScript(name string) string {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n" + hookMarker + "\n")
+	script.WriteString(`chained="$(dirname "$0")/` + name + chainedSuffix + "\"\n")
+	if name == "pre-push" {
+		// The refs being pushed arrive on STDIN, and both hooks need them
+		script.WriteString(`refs="$(cat)"` + "\n")
+		script.WriteString(`if [ -x "$chained" ]; then` + "\n")
+		script.WriteString(`    printf '%s\n' "$refs" | "$chained" "$@" || exit $?` + "\n")
+		script.WriteString("fi\n")
+		script.WriteString(`printf '%s\n' "$refs" | exec sdt hooks run ` + name + ` "$@"` + "\n")
+	} else {
+		script.WriteString(`if [ -x "$chained" ]; then` + "\n")
+		script.WriteString(`    "$chained" "$@" || exit $?` + "\n")
+		script.WriteString("fi\n")
+		script.WriteString(`exec sdt hooks run ` + name + ` "$@"` + "\n")
+	}
+	return script.String()
+}
+
+// InstallHooks writes our hooks into the repository's hooks directory,
+// moving aside any existing hook so that it is chained rather than lost
+func InstallHooks() error {
+	cmd := exec.Command("git", "rev-parse", "--git-path", "hooks")
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.New("Unable to locate git hooks directory")
+	}
+	hookDir := strings.TrimSpace(string(out))
+	if err := os.MkdirAll(hookDir, 0755); err != nil {
+		return errors.New("Unable to create git hooks directory " + hookDir)
+	}
+
+	for _, name := range HookNames {
+		path := filepath.Join(hookDir, name)
+		existing, err := os.ReadFile(path)
+		if err == nil && !strings.Contains(string(existing), hookMarker) {
+			chained := path + chainedSuffix
+			if _, err := os.Stat(chained); err == nil {
+				return errors.New("Both " + path + " and " + chained + " exist")
+			}
+			if err := os.Rename(path, chained); err != nil {
+				return errors.New("Unable to move aside existing hook " + path)
+			}
+			utils.Info("Existing %s hook will be run first, as %s", name, chained)
+		}
+		if err := os.WriteFile(path, []byte(HookScript(name)), 0755); err != nil {
+			return errors.New("Unable to write hook " + path)
+		}
+		utils.Info("Installed %s hook at %s", name, path)
+	}
+	return nil
+}
+
+// StagedResults analyzes the changes staged in the index relative to HEAD
+func StagedResults(options types.Options, config types.Config) ([]types.FileResult, error) {
+	head, err := RevParse("HEAD")
+	if err != nil {
+		head = emptyTree
+	}
+	cmd := exec.Command("git", "diff", "--cached", "--name-only", "--no-renames")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("Unable to list staged changes")
+	}
+
+	var results []types.FileResult
+	for _, path := range strings.Split(string(out), "\n") {
+		if path == "" {
+			continue
+		}
+		// An empty revision names the index in `git show :path`
+		result, _, err := CompareRevisions(head, "", path, options, config)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ClaimsCosmetic checks the subject line of a commit message against the
+// pattern for messages announcing style-only changes
+func ClaimsCosmetic(message string, pattern string) (bool, error) {
+	if pattern == "" {
+		pattern = DefaultStylePattern
+	}
+	reStyle, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("Invalid style_pattern %q (%s)", pattern, err)
+	}
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return reStyle.MatchString(line), nil
+	}
+	return false, nil
+}
+
+// filesWith names the results of one kind matching the glob pattern
+func filesWith(
+	results []types.FileResult,
+	change types.ChangeKind,
+	pattern string,
+) []string {
+	pat := glob.MustCompile(pattern)
+	var files []string
+	for _, result := range results {
+		if result.Change == change && pat.Match(result.Filename) {
+			files = append(files, result.Filename)
+		}
+	}
+	return files
+}
+
+// pushBase finds the revision a pushed ref should be compared against
+func pushBase(remote string, localSha string, remoteSha string) (string, error) {
+	against := remoteSha
+	if remoteSha == zeroHash {
+		// A new branch: compare with where the remote's default branch is
+		against = "refs/remotes/" + remote + "/HEAD"
+		if _, err := RevParse(against); err != nil {
+			return "", errors.New("The default branch of " + remote +
+				" is unknown (see `git remote set-head " + remote + " --auto`)")
+		}
+	}
+	cmd := exec.Command("git", "merge-base", localSha, against)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("No merge base for " + localSha + " and " + against)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// RunHook applies the policy for one hook.  A returned error rejects the
+// commit or push; warnings are only printed.
+func RunHook(
+	name string,
+	args []string,
+	stdin io.Reader,
+	options types.Options,
+	config types.Config,
+) error {
+	warn := color.New(color.FgYellow)
+
+	switch name {
+	case "pre-commit":
+		// Informational only: what may be committed is decided by the
+		// commit-msg hook, once the message is known
+		results, err := StagedResults(options, config)
+		if err != nil {
+			return err
+		}
+		counts := CountChanges(results, options.Glob)
+		utils.Info("Staged: %d semantic, %d cosmetic, %d unsupported",
+			counts.Semantic, counts.Cosmetic, counts.Unsupported)
+
+	case "commit-msg":
+		if len(args) < 1 {
+			return errors.New("The commit-msg hook requires the message file")
+		}
+		message, err := os.ReadFile(args[0])
+		if err != nil {
+			return errors.New("Unable to read commit message " + args[0])
+		}
+		claimed, err := ClaimsCosmetic(string(message), config.Hooks.StylePattern)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return nil
+		}
+		results, err := StagedResults(options, config)
+		if err != nil {
+			return err
+		}
+		semantic := filesWith(results, types.Semantic, options.Glob)
+		if len(semantic) > 0 {
+			return fmt.Errorf(
+				"Commit message claims a style change, but these files "+
+					"change semantically:\n\t%s", strings.Join(semantic, "\n\t"))
+		}
+
+	case "pre-push":
+		remote := "origin"
+		if len(args) > 0 {
+			remote = args[0]
+		}
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			// <local ref> <local sha> <remote ref> <remote sha>
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 4 || fields[1] == zeroHash {
+				continue
+			}
+			base, err := pushBase(remote, fields[1], fields[3])
+			if err != nil && config.Hooks.StrictPush {
+				return fmt.Errorf("Unable to analyze pushing %s: %s", fields[0], err)
+			} else if err != nil {
+				utils.Info("%s", err)
+				continue
+			}
+			files, err := ChangedFiles(base, fields[1])
+			if err != nil {
+				return err
+			}
+			var results []types.FileResult
+			for _, path := range files {
+				result, _, err := CompareRevisions(base, fields[1], path, options, config)
+				if err != nil {
+					return err
+				}
+				results = append(results, result)
+			}
+			unsupported := filesWith(results, types.Unsupported, options.Glob)
+			if len(unsupported) == 0 {
+				continue
+			}
+			msg := fmt.Sprintf("Pushing %s includes changes sdt cannot analyze:\n\t%s",
+				fields[0], strings.Join(unsupported, "\n\t"))
+			if config.Hooks.StrictPush {
+				return errors.New(msg)
+			}
+			warn.Println("WARNING: " + msg)
+		}
+
+	default:
+		return errors.New("No sdt policy for hook " + name)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package git_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/utils/git"
+)
+
+func TestHookScript(t *testing.T) {
+	for _, name := range git.HookNames {
+		script := git.HookScript(name)
+		if !strings.Contains(script, name+".sdt-chained") {
+			t.Fatalf("The %s hook does not chain to an existing hook", name)
+		}
+		if !strings.Contains(script, "sdt hooks run "+name+` "$@"`) {
+			t.Fatalf("The %s hook does not run the sdt policy", name)
+		}
+	}
+	if !strings.Contains(git.HookScript("pre-push"), `refs="$(cat)"`) {
+		t.Fatalf("The pre-push hook does not pass refs to both hooks")
+	}
+}
+
+func TestClaimsCosmetic(t *testing.T) {
+	claims := []string{
+		"style: reformat with black",
+		"# Please enter the commit message\n\nRun gofmt over pkg/ (fmt)",
+		"Fix lint warnings",
+	}
+	for _, message := range claims {
+		if claimed, _ := git.ClaimsCosmetic(message, ""); !claimed {
+			t.Fatalf("Message %q not recognized as claiming style change", message)
+		}
+	}
+	if claimed, _ := git.ClaimsCosmetic("Add formatter option\n\nstyle only", ""); claimed {
+		t.Fatalf("Message body rather than subject considered")
+	}
+	if claimed, _ := git.ClaimsCosmetic("chore: prettier", `(?i)prettier`); !claimed {
+		t.Fatalf("Configured style pattern not used")
+	}
+	if _, err := git.ClaimsCosmetic("style: tidy", `(?i)(style`); err == nil {
+		t.Fatalf("Invalid style pattern accepted")
+	}
+}
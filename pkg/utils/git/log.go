@@ -0,0 +1,123 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/gobwas/glob"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// Commit identifies one commit of a walk over history
+type Commit struct {
+	Hash    string
+	Subject string
+}
+
+// ChangeCounts tallies the per-file results of analyzing one commit
+type ChangeCounts struct {
+	Semantic    int
+	Cosmetic    int
+	Unsupported int
+}
+
+// CosmeticOnly is true when a commit changed files, but none semantically.
+// Files without an analyzer might hide semantic changes, so are allowed
+// only if allowUnsupported is set.
+func (counts ChangeCounts) CosmeticOnly(allowUnsupported bool) bool {
+	return counts.Semantic == 0 && counts.Cosmetic > 0 &&
+		(counts.Unsupported == 0 || allowUnsupported)
+}
+
+// LogCommits lists the commits of a revision range, newest first
+func LogCommits(revRange string, firstParent bool) ([]Commit, error) {
+	args := []string{"log", "--format=%H%x09%s"}
+	if firstParent {
+		args = append(args, "--first-parent")
+	}
+	cmd := exec.Command("git", append(args, revRange, "--")...)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("Unable to list commits in " + revRange)
+	}
+
+	var commits []Commit
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) == 2 {
+			commits = append(commits, Commit{Hash: parts[0], Subject: parts[1]})
+		}
+	}
+	return commits, nil
+}
+
+// CountChanges tallies results for those files matching the glob pattern
+func CountChanges(results []types.FileResult, pattern string) ChangeCounts {
+	pat := glob.MustCompile(pattern)
+	var counts ChangeCounts
+	for _, result := range results {
+		if !pat.Match(result.Filename) {
+			continue
+		}
+		switch result.Change {
+		case types.Semantic:
+			counts.Semantic++
+		case types.Cosmetic:
+			counts.Cosmetic++
+		case types.Unsupported:
+			counts.Unsupported++
+		}
+	}
+	return counts
+}
+
+// Log walks the commits of a range and analyzes each against its parent,
+// printing one line per commit with counts of each kind of file change
+func Log(revRange string, options types.Options, config types.Config) error {
+	commits, err := LogCommits(revRange, options.FirstParent)
+	if err != nil {
+		return err
+	}
+
+	header := color.New(color.FgWhite, color.Bold)
+	semantic := color.New(color.FgRed)
+	cosmetic := color.New(color.FgGreen)
+	other := color.New(color.FgCyan)
+
+	if len(commits) == 0 {
+		header.Println("No commits in range")
+		return nil
+	}
+	if options.Cosmetic {
+		header.Printf("Cosmetic-only commits in %s:\n", revRange)
+	} else {
+		header.Printf("Semantic analysis of commits in %s:\n", revRange)
+	}
+
+	for _, commit := range commits {
+		results, _, err := CommitResults(commit.Hash, options, config)
+		if err != nil {
+			return err
+		}
+		counts := CountChanges(results, options.Glob)
+		if options.Cosmetic && !counts.CosmeticOnly(options.AllowUnsupported) {
+			continue
+		}
+
+		line := fmt.Sprintf("%.7s  semantic %2d  cosmetic %2d  unsupported %2d  %s",
+			commit.Hash, counts.Semantic, counts.Cosmetic, counts.Unsupported,
+			commit.Subject)
+		if counts.Semantic > 0 {
+			semantic.Println(line)
+		} else if counts.Cosmetic > 0 {
+			cosmetic.Println(line)
+		} else {
+			other.Println(line)
+		}
+	}
+	return nil
+}
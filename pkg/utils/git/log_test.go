@@ -0,0 +1,64 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+	"github.com/atlantistechnology/sdt/pkg/utils/git"
+)
+
+var commitResults = []types.FileResult{
+	{Filename: "a.py", Language: "Python", Change: types.Cosmetic},
+	{Filename: "b.py", Language: "Python", Change: types.Cosmetic},
+	{Filename: "c.go", Language: "Go", Change: types.Semantic},
+	{Filename: "README.md", Language: "Tree-sitter", Change: types.Unsupported},
+}
+
+func TestCountChanges(t *testing.T) {
+	counts := git.CountChanges(commitResults, "*")
+	want := git.ChangeCounts{Semantic: 1, Cosmetic: 2, Unsupported: 1}
+	if counts != want {
+		t.Fatalf("CountChanges() produced %v rather than %v", counts, want)
+	}
+	if counts.CosmeticOnly(false) {
+		t.Fatalf("Commit with a semantic change judged cosmetic-only")
+	}
+}
+
+func TestCountChangesGlob(t *testing.T) {
+	counts := git.CountChanges(commitResults, "*.py")
+	want := git.ChangeCounts{Semantic: 0, Cosmetic: 2, Unsupported: 0}
+	if counts != want {
+		t.Fatalf("CountChanges() produced %v rather than %v", counts, want)
+	}
+	if !counts.CosmeticOnly(false) {
+		t.Fatalf("Commit with only cosmetic changes not judged cosmetic-only")
+	}
+}
+
+func TestCosmeticOnlyUnsupported(t *testing.T) {
+	counts := git.CountChanges(
+		[]types.FileResult{commitResults[0], commitResults[3]}, "*")
+	if counts.CosmeticOnly(false) {
+		t.Fatalf("Commit with an unsupported file judged cosmetic-only")
+	}
+	if !counts.CosmeticOnly(true) {
+		t.Fatalf("Commit with cosmetic and allowed unsupported files not judged cosmetic-only")
+	}
+}
+
+var fileHistoryOutput = "\x01bbbbbbb\tMove helpers\n\npkg/new.py\n" +
+	"\x01aaaaaaa\tAdd helpers\n\npkg/old.py\n"
+
+func TestParseFileHistory(t *testing.T) {
+	revisions := git.ParseFileHistory(fileHistoryOutput)
+	if len(revisions) != 2 {
+		t.Fatalf("ParseFileHistory() found %d revisions rather than 2", len(revisions))
+	}
+	if revisions[0].Hash != "aaaaaaa" || revisions[0].Path != "pkg/old.py" {
+		t.Fatalf("ParseFileHistory() not oldest first: %v", revisions)
+	}
+	if revisions[1].Subject != "Move helpers" || revisions[1].Path != "pkg/new.py" {
+		t.Fatalf("ParseFileHistory() misread revision: %v", revisions[1])
+	}
+}
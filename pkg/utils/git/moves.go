@@ -0,0 +1,101 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// declarationTree builds the tree model of a file at a revision, given as
+// "rev:" in the manner of options.Source, or of the file on disk when the
+// revision is empty.  It is nil when the file is absent or does not parse.
+func declarationTree(
+	analyzer types.Analyzer,
+	rev string,
+	path string,
+	config types.Config,
+) *treediff.Node {
+	filename := path
+	if rev != "" {
+		body, found := ShowFile(strings.TrimSuffix(rev, ":"), path)
+		if !found {
+			return nil
+		}
+		// Tools such as tree-sitter select a grammar by extension, so keep it
+		tmpfile, err := os.CreateTemp("", "*-"+strings.ReplaceAll(path, "/", ":"))
+		if err != nil {
+			return nil
+		}
+		defer os.Remove(tmpfile.Name()) // clean up
+		tmpfile.Write(body)
+		tmpfile.Close()
+		filename = tmpfile.Name()
+	} else if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	raw, err := analyzer.RawTree(filename, config)
+	if err != nil {
+		return nil
+	}
+	tree, err := treediff.Parse(raw, analyzer.Parse, nil)
+	if err != nil {
+		return nil
+	}
+	treediff.NormalizeLiterals(tree, analyzer.Parse)
+	return tree
+}
+
+// CrossFileMoves finds the declarations that moved from one to another of
+// the files added, removed, or modified between two revisions, as when a
+// module is split or several merged.  An empty destination is the files on
+// disk.  Files in formats without a tree model are not considered.
+func CrossFileMoves(
+	paths []string,
+	source string,
+	destination string,
+	config types.Config,
+) []treediff.FileMove {
+	before := map[string]*treediff.Node{}
+	after := map[string]*treediff.Node{}
+	for _, path := range paths {
+		analyzer, _ := FileAnalyzer(filepath.Ext(path))
+		if analyzer.RawTree == nil || !treediff.Supported(analyzer.Parse) {
+			continue
+		}
+		before[path] = declarationTree(analyzer, source, path, config)
+		after[path] = declarationTree(analyzer, destination, path, config)
+	}
+	return treediff.CrossFileMoves(before, after)
+}
+
+// reportCrossFileMoves lists the declarations moved between files, if any
+func reportCrossFileMoves(
+	paths []string,
+	options types.Options,
+	config types.Config,
+) {
+	if !options.Semantic || options.RulesTest || len(paths) < 2 {
+		return
+	}
+	moves := CrossFileMoves(paths, options.Source, options.Destination, config)
+	if len(moves) == 0 {
+		return
+	}
+	header := color.New(color.FgWhite, color.Bold)
+	unchanged := color.New(color.FgMagenta)
+	modified := color.New(color.FgCyan)
+	header.Println("Declarations moved between files:")
+	for _, move := range moves {
+		if move.Modified {
+			modified.Println("   " + move.String())
+		} else {
+			unchanged.Println("   " + move.String())
+		}
+	}
+}
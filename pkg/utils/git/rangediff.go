@@ -0,0 +1,181 @@
+package git
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/gobwas/glob"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// CommitPair is one line of `git range-diff` output.  The Relation is the
+// marker git uses: "=" identical patch, "!" changed patch, "<" only in the
+// old series, ">" only in the new series.
+type CommitPair struct {
+	OldCommit string
+	NewCommit string
+	Relation  string
+	Subject   string
+}
+
+var reRangeDiff = regexp.MustCompile(
+	`^ *(?:\d+|-): +([0-9a-f]+|-+) ([=!<>]) +(?:\d+|-): +([0-9a-f]+|-+) (.*)$`)
+
+// ParseRangeDiff reads the output of `git range-diff --no-patch`.  Commits
+// left unpaired by git but sharing a subject line are paired here, since a
+// reworked commit often differs too much textually for git to match it.
+func ParseRangeDiff(out string) []CommitPair {
+	var pairs []CommitPair
+	for _, line := range strings.Split(out, "\n") {
+		m := reRangeDiff.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		pair := CommitPair{Relation: m[2], Subject: m[4]}
+		if !strings.HasPrefix(m[1], "-") {
+			pair.OldCommit = m[1]
+		}
+		if !strings.HasPrefix(m[3], "-") {
+			pair.NewCommit = m[3]
+		}
+		pairs = append(pairs, pair)
+	}
+
+	var merged []CommitPair
+	for _, pair := range pairs {
+		if pair.Relation == ">" {
+			matched := false
+			for i, prior := range merged {
+				if prior.Relation == "<" && prior.Subject == pair.Subject {
+					merged[i].NewCommit = pair.NewCommit
+					merged[i].Relation = "!"
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+		}
+		merged = append(merged, pair)
+	}
+	return merged
+}
+
+// touchesGlob reports whether either commit of a pair changes a path
+// matching the pattern
+func touchesGlob(pair CommitPair, pat glob.Glob) (bool, error) {
+	for _, commit := range []string{pair.OldCommit, pair.NewCommit} {
+		if commit == "" {
+			continue
+		}
+		files, err := ChangedFiles(ParentOf(commit), commit)
+		if err != nil {
+			return false, err
+		}
+		for _, path := range files {
+			if pat.Match(path) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// RangeDiff pairs the commits of two revision ranges in the manner of
+// `git range-diff`, and reports for each changed pair whether the semantic
+// effect of the commit changed, ignoring context shifts and formatting.
+// Pairs whose commits change no path matching options.Glob are omitted.
+func RangeDiff(
+	oldRange string,
+	newRange string,
+	options types.Options,
+	config types.Config,
+) error {
+	cmd := exec.Command("git", "range-diff", "--no-color", "--no-patch",
+		oldRange, newRange)
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.New("Unable to compare ranges " + oldRange + " and " + newRange)
+	}
+
+	header := color.New(color.FgWhite, color.Bold)
+	same := color.New(color.FgGreen)
+	differ := color.New(color.FgRed)
+	unpaired := color.New(color.FgMagenta)
+	diffColor := color.New(color.FgYellow)
+
+	pat := glob.MustCompile(options.Glob)
+	pairs := ParseRangeDiff(string(out))
+	if len(pairs) == 0 {
+		header.Println("No commits in either range")
+		return nil
+	}
+	header.Printf("Commit pairs between %s and %s:\n", oldRange, newRange)
+
+	for _, pair := range pairs {
+		matched, err := touchesGlob(pair, pat)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		oldName := pair.OldCommit
+		newName := pair.NewCommit
+		if pair.OldCommit == "" {
+			oldName = "-------"
+		}
+		if pair.NewCommit == "" {
+			newName = "-------"
+		}
+		summary := "    " + oldName + " " + pair.Relation + " " + newName +
+			" " + pair.Subject
+
+		switch pair.Relation {
+		case "=":
+			same.Println(summary)
+			diffColor.Println("| Identical patch")
+		case "<":
+			unpaired.Println(summary)
+			diffColor.Println("| Commit dropped from new series")
+		case ">":
+			unpaired.Println(summary)
+			diffColor.Println("| Commit added in new series")
+		case "!":
+			oldEffect, oldPlain, err := CommitEffect(pair.OldCommit, options, config)
+			if err != nil {
+				return err
+			}
+			newEffect, newPlain, err := CommitEffect(pair.NewCommit, options, config)
+			if err != nil {
+				return err
+			}
+			var changes []string
+			for _, path := range EffectChanges(oldEffect, newEffect) {
+				if pat.Match(path) {
+					changes = append(changes, path)
+				}
+			}
+			if len(changes) == 0 {
+				same.Println(summary)
+				diffColor.Println("| No change in semantic effect")
+				continue
+			}
+			differ.Println(summary)
+			diffColor.Println("| Semantic effect changed:")
+			for _, path := range changes {
+				if oldPlain[path] || newPlain[path] {
+					diffColor.Println("|     " + path + " (no analyzer, compared as text)")
+				} else {
+					diffColor.Println("|     " + path)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package git_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/utils/git"
+)
+
+var rangeDiffOutput = `1:  304aebc = 1:  cbe07e8 add f
+2:  d702148 ! 2:  4486d99 y
+3:  1a2b3c4 < -:  ------- dropped
+-:  ------- > 3:  0150ef1 z
+4:  5d6e7f8 < -:  ------- reworked
+-:  ------- > 4:  9a8b7c6 reworked
+`
+
+func TestParseRangeDiff(t *testing.T) {
+	want := []git.CommitPair{
+		{OldCommit: "304aebc", NewCommit: "cbe07e8", Relation: "=", Subject: "add f"},
+		{OldCommit: "d702148", NewCommit: "4486d99", Relation: "!", Subject: "y"},
+		{OldCommit: "1a2b3c4", NewCommit: "", Relation: "<", Subject: "dropped"},
+		{OldCommit: "", NewCommit: "0150ef1", Relation: ">", Subject: "z"},
+		// Unpaired commits with the same subject are paired as changed
+		{OldCommit: "5d6e7f8", NewCommit: "9a8b7c6", Relation: "!", Subject: "reworked"},
+	}
+	pairs := git.ParseRangeDiff(rangeDiffOutput)
+	if !reflect.DeepEqual(pairs, want) {
+		t.Fatalf("ParseRangeDiff() produced %v rather than %v", pairs, want)
+	}
+}
+
+func TestEffectChanges(t *testing.T) {
+	old := git.Effect{
+		"a.py": []string{"-x", "+y"},
+		"b.py": []string{"+z"},
+		"c.py": []string{"+w"},
+	}
+	new := git.Effect{
+		"a.py": []string{"-x", "+y"},
+		"b.py": []string{"+zz"},
+		"d.py": []string{"-v"},
+	}
+	want := []string{"b.py", "c.py", "d.py"}
+	changes := git.EffectChanges(old, new)
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("EffectChanges() produced %v rather than %v", changes, want)
+	}
+}
@@ -0,0 +1,271 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+	"github.com/atlantistechnology/sdt/pkg/utils"
+)
+
+// Git's well-known hash of the empty tree, used as "parent" of root commits
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// Effect is the semantic footprint of one commit.  For each changed file it
+// holds the sorted lines of normalized tree removed ("-") and added ("+"),
+// so context shifts and formatting do not enter into comparisons.
+type Effect map[string][]string
+
+// RevParse resolves a revision name to its full commit hash
+func RevParse(rev string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("Unknown revision " + rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ParentOf gives the first parent of a commit, or the empty tree for a root
+func ParentOf(commit string) string {
+	parent, err := RevParse(commit + "^")
+	if err != nil {
+		return emptyTree
+	}
+	return parent
+}
+
+// ChangedFiles lists the paths that differ between two revisions
+func ChangedFiles(from string, to string) ([]string, error) {
+	cmd := exec.Command("git", "diff", "--name-only", "--no-renames", from, to)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("Unable to diff " + from + " and " + to)
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// ShowFile retrieves the body of a path at a revision.  The boolean is false
+// when the path does not exist at that revision.
+func ShowFile(rev string, path string) ([]byte, bool) {
+	if rev == emptyTree {
+		return nil, false
+	}
+	cmd := exec.Command("git", "show", rev+":"+path)
+	body, err := cmd.Output()
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
+
+// TreeAtRevision produces the normalized representation sdt compares for a
+// path as it exists at a revision.  A missing file has an empty tree.  The
+// boolean reports whether an analyzer was available and succeeded; if not,
+// the raw text of the file is returned so callers may compare it verbatim.
+func TreeAtRevision(
+	rev string,
+	path string,
+	config types.Config,
+) (string, bool, error) {
+	body, found := ShowFile(rev, path)
+	if !found {
+		_, _, err := FileTreer(filepath.Ext(path))
+		return "", err == nil, nil
+	}
+
+	// Tools such as tree-sitter select a grammar by extension, so keep it
+	tmpName := "*-" + strings.ReplaceAll(path, "/", ":")
+	tmpfile, err := os.CreateTemp("", tmpName)
+	if err != nil {
+		return "", false, errors.New("Could not create temporary file for " + path)
+	}
+	defer os.Remove(tmpfile.Name()) // clean up
+	tmpfile.Write(body)
+	tmpfile.Close()
+
+	treer, _, _ := FileTreer(filepath.Ext(path))
+	tree, err := treer(tmpfile.Name(), config)
+	if err != nil {
+		// No grammar for the format, or this revision does not parse
+		return string(body), false, nil
+	}
+	return tree, true, nil
+}
+
+// treeDelta lists the lines removed and added between two trees, ignoring
+// the unchanged context around them
+func treeDelta(before string, after string) []string {
+	diffs := utils.DiffLines(before, after)
+
+	var delta []string
+	for _, diff := range diffs {
+		var prefix string
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+		default:
+			continue
+		}
+		text := strings.TrimSuffix(diff.Text, "\n")
+		for _, line := range strings.Split(text, "\n") {
+			delta = append(delta, prefix+strings.TrimRight(line, "\r\t "))
+		}
+	}
+	sort.Strings(delta)
+	return delta
+}
+
+// compareBodies analyzes two versions of a path as the semantic diff of
+// two local files does, saving each to a temporary file for the analyzer
+func compareBodies(
+	path string,
+	before []byte,
+	after []byte,
+	options types.Options,
+	config types.Config,
+) (types.FileResult, error) {
+	var names []string
+	for _, body := range [][]byte{before, after} {
+		// Tools such as tree-sitter select a grammar by extension, so keep it
+		tmpfile, err := os.CreateTemp("", "*-"+strings.ReplaceAll(path, "/", ":"))
+		if err != nil {
+			return types.FileResult{}, errors.New("Could not create temporary file for " + path)
+		}
+		defer os.Remove(tmpfile.Name()) // clean up
+		tmpfile.Write(body)
+		tmpfile.Close()
+		names = append(names, tmpfile.Name())
+	}
+
+	perFileOpts := options
+	perFileOpts.Semantic, perFileOpts.Parsetree = true, false
+	perFileOpts.RulesTest = false
+	perFileOpts.Source, perFileOpts.Destination = names[0], names[1]
+	result, _ := analyzeFile(filepath.Ext(path), "", perFileOpts, config)
+	result.Filename = path
+	return result, nil
+}
+
+// CompareRevisions classifies the change to one path between revisions,
+// judged by the same analysis as a semantic diff with the options.  The
+// lines of normalized tree removed and added are also returned.
+func CompareRevisions(
+	from string,
+	to string,
+	path string,
+	options types.Options,
+	config types.Config,
+) (types.FileResult, []string, error) {
+	_, language, err := FileTreer(filepath.Ext(path))
+	if err != nil {
+		language = "Tree-sitter"
+	}
+	result := types.FileResult{Filename: path, Language: language}
+
+	before, okBefore, err := TreeAtRevision(from, path, config)
+	if err != nil {
+		return result, nil, err
+	}
+	after, okAfter, err := TreeAtRevision(to, path, config)
+	if err != nil {
+		return result, nil, err
+	}
+
+	delta := treeDelta(before, after)
+
+	beforeBody, foundBefore := ShowFile(from, path)
+	afterBody, foundAfter := ShowFile(to, path)
+	switch {
+	case !okBefore || !okAfter:
+		result.Change = types.Unsupported
+	case foundBefore && foundAfter:
+		result, err = compareBodies(path, beforeBody, afterBody, options, config)
+		if err != nil {
+			return result, nil, err
+		}
+	case len(delta) == 0:
+		// A file added or removed empty
+		result.Change = types.Cosmetic
+	default:
+		result.Change = types.Semantic
+	}
+	return result, delta, nil
+}
+
+// CommitResults analyzes every file a commit changes relative to its first
+// parent, returning both the per-file classification and the Effect
+func CommitResults(
+	commit string,
+	options types.Options,
+	config types.Config,
+) ([]types.FileResult, Effect, error) {
+	var results []types.FileResult
+	effect := Effect{}
+	parent := ParentOf(commit)
+	files, err := ChangedFiles(parent, commit)
+	if err != nil {
+		return results, effect, err
+	}
+
+	for _, path := range files {
+		result, delta, err := CompareRevisions(parent, commit, path, options, config)
+		if err != nil {
+			return results, effect, err
+		}
+		results = append(results, result)
+		if len(delta) > 0 {
+			effect[path] = delta
+		}
+	}
+	return results, effect, nil
+}
+
+// CommitEffect computes the Effect of a commit relative to its first parent.
+// The returned set names those files for which no analyzer was available,
+// and whose effect is therefore a plain textual one.
+func CommitEffect(
+	commit string,
+	options types.Options,
+	config types.Config,
+) (Effect, map[string]bool, error) {
+	unanalyzed := map[string]bool{}
+	results, effect, err := CommitResults(commit, options, config)
+	for _, result := range results {
+		if result.Change == types.Unsupported {
+			unanalyzed[result.Filename] = true
+		}
+	}
+	return effect, unanalyzed, err
+}
+
+// EffectChanges names the files whose effect differs between two commits
+func EffectChanges(old Effect, new Effect) []string {
+	var files []string
+	for path, delta := range old {
+		if strings.Join(delta, "\n") != strings.Join(new[path], "\n") {
+			files = append(files, path)
+		}
+	}
+	for path := range new {
+		if _, found := old[path]; !found {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
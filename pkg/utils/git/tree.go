@@ -0,0 +1,97 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+	"github.com/atlantistechnology/sdt/pkg/utils"
+)
+
+// treeSource reads the file a target names, either a path on disk or
+// "rev:path" for the path as it exists at a revision
+func treeSource(target string) (string, []byte, error) {
+	if body, err := os.ReadFile(target); err == nil {
+		return target, body, nil
+	}
+	rev, path, found := strings.Cut(target, ":")
+	if !found || rev == "" || path == "" {
+		return "", nil, errors.New("The file " + target + " does not exist!")
+	}
+	body, found := ShowFile(rev, path)
+	if !found {
+		return "", nil, errors.New("The file " + path + " does not exist at " + rev)
+	}
+	return path, body, nil
+}
+
+// PrintTree writes the representation of one file that sdt compares: the
+// parse tree as cleaned, or canonical form, that parsetree and the commit
+// walks compare; with options.Raw the output of the configured parser
+// itself; and with options.JSON the tree model that semantic diffs match,
+// after normalizing literals, rewrite rules, and unordered constructs.
+// The parser is given the text as normalized for encoding and line ends.
+func PrintTree(target string, options types.Options, config types.Config) error {
+	path, body, err := treeSource(target)
+	if err != nil {
+		return err
+	}
+	// Without a built-in analyzer, tree-sitter may know the format
+	analyzer, _ := FileAnalyzer(filepath.Ext(path))
+	text, _ := utils.Normalize(body)
+
+	// Tools such as tree-sitter select a grammar by extension, so keep it
+	tmpfile, err := os.CreateTemp("", "*-"+filepath.Base(path))
+	if err != nil {
+		return errors.New("Could not create temporary file for " + path)
+	}
+	defer os.Remove(tmpfile.Name()) // clean up
+	tmpfile.Write(text)
+	tmpfile.Close()
+
+	failed := func(err error) error {
+		return fmt.Errorf("Unable to produce the tree of %s (%s)", path, err)
+	}
+	switch {
+	case options.JSON:
+		if analyzer.RawTree == nil || !treediff.Supported(analyzer.Parse) {
+			return errors.New(analyzer.Name +
+				" files have no tree model, and are compared in canonical form")
+		}
+		raw, err := analyzer.RawTree(tmpfile.Name(), config)
+		if err != nil {
+			return failed(err)
+		}
+		tree, err := utils.ModelTree(raw, text, analyzer.Parse, config)
+		if err != nil {
+			return failed(err)
+		}
+		out, err := json.MarshalIndent(tree, "", "  ")
+		if err != nil {
+			return failed(err)
+		}
+		fmt.Println(string(out))
+	case options.Raw && analyzer.RawTree != nil:
+		raw, err := analyzer.RawTree(tmpfile.Name(), config)
+		if err != nil {
+			return failed(err)
+		}
+		fmt.Print(strings.TrimRight(string(raw), "\n") + "\n")
+	default:
+		if options.Raw {
+			utils.Info("%s files are compared in canonical form, which is their raw form",
+				analyzer.Name)
+		}
+		tree, err := analyzer.Tree(tmpfile.Name(), config)
+		if err != nil {
+			return failed(err)
+		}
+		fmt.Print(strings.TrimRight(tree, "\n") + "\n")
+	}
+	return nil
+}
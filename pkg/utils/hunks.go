@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DiffLine is one line of a unified diff hunk.  Old and New give its line
+// in each file; for a line present in only one file, the other is the
+// line of that file which follows the change.
+type DiffLine struct {
+	Op   byte // ' ', '-', or '+'
+	Text string
+	Old  int
+	New  int
+}
+
+// Hunk is one `@@` segment of a unified diff
+type Hunk struct {
+	OldStart int
+	OldCount int
+	NewStart int
+	NewCount int
+	Section  string // Any text following the range, e.g. a function name
+	Lines    []DiffLine
+}
+
+var reHunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// ParseHunks reads the hunks of the output of `git diff` or `diff -u`,
+// skipping the file headers
+func ParseHunks(diff []byte) []Hunk {
+	var hunks []Hunk
+	var hunk *Hunk
+	oldLine, newLine := 0, 0
+	for _, line := range strings.Split(string(diff), "\n") {
+		if m := reHunkHeader.FindStringSubmatch(line); m != nil {
+			hunks = append(hunks, Hunk{
+				OldStart: atoiOr(m[1], 0),
+				OldCount: atoiOr(m[2], 1),
+				NewStart: atoiOr(m[3], 0),
+				NewCount: atoiOr(m[4], 1),
+				Section:  m[5],
+			})
+			hunk = &hunks[len(hunks)-1]
+			oldLine, newLine = hunk.OldStart, hunk.NewStart
+			// An empty side is numbered from the line preceding the change
+			if hunk.OldCount == 0 {
+				oldLine++
+			}
+			if hunk.NewCount == 0 {
+				newLine++
+			}
+			continue
+		}
+		if hunk == nil || line == "" || (line[0] != ' ' && line[0] != '-' && line[0] != '+') {
+			continue
+		}
+		hunk.Lines = append(hunk.Lines,
+			DiffLine{Op: line[0], Text: line[1:], Old: oldLine, New: newLine})
+		if line[0] != '+' {
+			oldLine++
+		}
+		if line[0] != '-' {
+			newLine++
+		}
+	}
+	return hunks
+}
+
+// Header renders the `@@` line of a hunk
+func (hunk Hunk) Header() string {
+	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@",
+		hunk.OldStart, hunk.OldCount, hunk.NewStart, hunk.NewCount)
+	if hunk.Section != "" {
+		header += " " + hunk.Section
+	}
+	return header
+}
+
+// Narrow splits a hunk into smaller hunks holding only those runs of
+// changed lines where keep is true of some line, each with up to context
+// unchanged lines around it
+func (hunk Hunk) Narrow(keep func(DiffLine) bool, context int) []Hunk {
+	lines := hunk.Lines
+	included := make([]bool, len(lines))
+	for start := 0; start < len(lines); {
+		if lines[start].Op == ' ' {
+			start++
+			continue
+		}
+		end := start
+		wanted := false
+		for ; end < len(lines) && lines[end].Op != ' '; end++ {
+			wanted = wanted || keep(lines[end])
+		}
+		if wanted {
+			from := Max(start-context, 0)
+			to := Min(end+context, len(lines))
+			for i := from; i < to; i++ {
+				included[i] = true
+			}
+		}
+		start = end
+	}
+
+	var hunks []Hunk
+	for start := 0; start < len(lines); start++ {
+		if !included[start] {
+			continue
+		}
+		end := start
+		for end < len(lines) && included[end] {
+			end++
+		}
+		// The section names what precedes the hunk, so is kept only by a
+		// narrowed hunk starting at the same line
+		section := ""
+		if start == 0 {
+			section = hunk.Section
+		}
+		hunks = append(hunks, subHunk(lines[start:end], section))
+		start = end
+	}
+	return hunks
+}
+
+// subHunk makes a hunk of consecutive lines taken from another
+func subHunk(lines []DiffLine, section string) Hunk {
+	hunk := Hunk{
+		OldStart: lines[0].Old,
+		NewStart: lines[0].New,
+		Section:  section,
+		Lines:    lines,
+	}
+	for _, line := range lines {
+		if line.Op != '+' {
+			hunk.OldCount++
+		}
+		if line.Op != '-' {
+			hunk.NewCount++
+		}
+	}
+	if hunk.OldCount == 0 {
+		hunk.OldStart--
+	}
+	if hunk.NewCount == 0 {
+		hunk.NewStart--
+	}
+	return hunk
+}
+
+func atoiOr(s string, fallback int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,55 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/utils"
+)
+
+// Unchanged blank lines are a lone space in a unified diff
+var unifiedDiff = "--- a/calc.py\n+++ b/calc.py\n" +
+	"@@ -1,9 +1,9 @@ import math\n" +
+	" def add(a, b):\n" +
+	"-    total = a + b\n" +
+	"+    total = a+b\n" +
+	"     return total\n" +
+	" \n \n" +
+	" def sub(a, b):\n" +
+	"-    diff = a - b\n" +
+	"+    diff = b - a\n" +
+	"     return diff\n"
+
+func TestParseHunks(t *testing.T) {
+	hunks := utils.ParseHunks([]byte(unifiedDiff))
+	if len(hunks) != 1 || len(hunks[0].Lines) != 10 {
+		t.Fatalf("ParseHunks() found %d hunks", len(hunks))
+	}
+	hunk := hunks[0]
+	if hunk.Header() != "@@ -1,9 +1,9 @@ import math" {
+		t.Fatalf("Wrong header %q", hunk.Header())
+	}
+	removed := hunk.Lines[7]
+	if removed.Op != '-' || removed.Old != 7 || removed.New != 7 {
+		t.Fatalf("Wrong numbering of %+v", removed)
+	}
+	added := hunk.Lines[8]
+	if added.Op != '+' || added.Old != 8 || added.New != 7 {
+		t.Fatalf("Wrong numbering of %+v", added)
+	}
+}
+
+func TestNarrow(t *testing.T) {
+	hunk := utils.ParseHunks([]byte(unifiedDiff))[0]
+	narrowed := hunk.Narrow(func(line utils.DiffLine) bool {
+		return line.New == 7
+	}, 1)
+	if len(narrowed) != 1 {
+		t.Fatalf("Narrow() produced %d hunks", len(narrowed))
+	}
+	if narrowed[0].Header() != "@@ -6,3 +6,3 @@" {
+		t.Fatalf("Wrong narrowed header %q", narrowed[0].Header())
+	}
+	if len(narrowed[0].Lines) != 4 || narrowed[0].Lines[1].Text != "    diff = a - b" {
+		t.Fatalf("Wrong narrowed lines %+v", narrowed[0].Lines)
+	}
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// Positions translates offsets into a text, counted in the unit a parser
+// reports, into 1-based lines and 0-based byte columns.  Lines are split on
+// LF, as in MakeOffsetsFromByteArray().
+type Positions struct {
+	text   []byte
+	unit   string
+	starts []int // Offset of the start of each line, in the unit
+	bytes  []int // Offset of the start of each line, in bytes
+}
+
+// unitWidth counts the units one rune occupies
+func unitWidth(r rune, size int, unit string) int {
+	switch unit {
+	case types.RuneOffsets:
+		return 1
+	case types.UTF16Offsets:
+		if r >= 0x10000 {
+			return 2 // A surrogate pair
+		}
+		return 1
+	}
+	return size
+}
+
+// NewPositions indexes the lines of a text for offsets in a unit, where an
+// empty unit means bytes
+func NewPositions(text []byte, unit string) *Positions {
+	p := &Positions{text: text, unit: unit, starts: []int{0}, bytes: []int{0}}
+	offset := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		offset += unitWidth(r, size, unit)
+		i += size
+		if r == '\n' {
+			p.starts = append(p.starts, offset)
+			p.bytes = append(p.bytes, i)
+		}
+	}
+	return p
+}
+
+// LineCol finds the line and byte column of an offset.  Offsets past the
+// end of the text fall on its last line.
+func (p *Positions) LineCol(offset int) (int, int) {
+	line := sort.Search(len(p.starts), func(i int) bool {
+		return p.starts[i] > offset
+	}) - 1
+	if line < 0 {
+		return 1, 0
+	}
+	i := p.bytes[line]
+	for units := p.starts[line]; units < offset && i < len(p.text); {
+		r, size := utf8.DecodeRune(p.text[i:])
+		if r == '\n' {
+			break
+		}
+		units += unitWidth(r, size, p.unit)
+		i += size
+	}
+	return line + 1, i - p.bytes[line]
+}
@@ -0,0 +1,36 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/atlantistechnology/sdt/pkg/types"
+	"github.com/atlantistechnology/sdt/pkg/utils"
+)
+
+// The second line starts after 8 bytes, 4 runes, or 5 UTF-16 code units
+var multibyte = []byte("é😀x\ny = 1\n")
+
+func TestPositionUnits(t *testing.T) {
+	cases := []struct {
+		unit   string
+		offset int
+		line   int
+		col    int
+	}{
+		{types.ByteOffsets, 7, 1, 7},
+		{types.ByteOffsets, 12, 2, 4},
+		{types.RuneOffsets, 2, 1, 6},
+		{types.RuneOffsets, 8, 2, 4},
+		{types.UTF16Offsets, 3, 1, 6},
+		{types.UTF16Offsets, 9, 2, 4},
+		{"", 12, 2, 4},
+	}
+	for _, c := range cases {
+		positions := utils.NewPositions(multibyte, c.unit)
+		line, col := positions.LineCol(c.offset)
+		if line != c.line || col != c.col {
+			t.Fatalf("LineCol(%d) in %q units is %d:%d rather than %d:%d",
+				c.offset, c.unit, line, col, c.line, c.col)
+		}
+	}
+}
@@ -9,14 +9,14 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 
 	"golang.org/x/exp/constraints"
 
-	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/sergi/go-diff/diffmatchpatch"
 
+	"github.com/atlantistechnology/sdt/pkg/treediff"
 	"github.com/atlantistechnology/sdt/pkg/types"
 )
 
@@ -37,7 +37,8 @@ type LineOffset struct {
 	Line  string
 }
 
-// We assume that lines are sensibly split on LF, not CR or CRLF
+// We assume that lines are sensibly split on LF, not CR or CRLF, as they
+// are once text is passed through Normalize()
 func MakeOffsetsFromString(text string) []LineOffset {
 	lines := strings.Split(text, "\n")
 	var records []LineOffset
@@ -53,7 +54,8 @@ func MakeOffsetsFromString(text string) []LineOffset {
 	return records
 }
 
-// We assume that lines are sensibly split on LF, not CR or CRLF
+// We assume that lines are sensibly split on LF, not CR or CRLF, as they
+// are once text is passed through Normalize()
 // Also assume that bytes encode text as UTF-8 not any odd encoding
 func MakeOffsetsFromByteArray(text []byte) []LineOffset {
 	lines := bytes.Split(text, []byte("\n"))
@@ -82,6 +84,27 @@ func LineAtPosition(records []LineOffset, pos uint32) int {
 	return -1
 }
 
+// IndentOf measures the leading indentation of a line of tree text, where
+// pad names the characters that make up indentation in that format
+func IndentOf(line string, pad string) int {
+	return len(line) - len(strings.TrimLeft(line, pad))
+}
+
+// IndentedSubtree returns the node at lines[start] together with all of the
+// following lines indented more deeply.  The node's own indentation is
+// removed, so that the same subtree nested at another depth compares equal.
+func IndentedSubtree(lines []string, start int, pad string) []string {
+	depth := IndentOf(lines[start], pad)
+	subtree := []string{lines[start][depth:]}
+	for _, line := range lines[start+1:] {
+		if strings.TrimSpace(line) == "" || IndentOf(line, pad) <= depth {
+			break
+		}
+		subtree = append(subtree, line[depth:])
+	}
+	return subtree
+}
+
 func Min[T constraints.Ordered](a, b T) T {
 	if a < b {
 		return a
@@ -96,6 +119,49 @@ func Max[T constraints.Ordered](a, b T) T {
 	return b
 }
 
+// DiffLines performs a line-by-line diff of two texts.  The line encoding
+// helpers of go-diff v1.2.0 mangle line indices, so we map each distinct
+// line to a rune here (stepping around the UTF-16 surrogate range).
+func DiffLines(before string, after string) []diffmatchpatch.Diff {
+	index := map[string]rune{}
+	var lines []string
+	encode := func(text string) []rune {
+		var runes []rune
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if line == "" {
+				continue
+			}
+			r, found := index[line]
+			if !found {
+				r = rune(len(lines))
+				if r >= 0xD800 {
+					r += 0x800
+				}
+				index[line] = r
+				lines = append(lines, line)
+			}
+			runes = append(runes, r)
+		}
+		return runes
+	}
+
+	dmp := diffmatchpatch.New()
+	a := encode(before)
+	b := encode(after)
+	diffs := dmp.DiffMainRunes(a, b, false)
+	for i, diff := range diffs {
+		var text strings.Builder
+		for _, r := range diff.Text {
+			if r >= 0xE000 {
+				r -= 0x800
+			}
+			text.WriteString(lines[r])
+		}
+		diffs[i].Text = text.String()
+	}
+	return diffs
+}
+
 func BufferToDiff(buff bytes.Buffer,
 	colorLeft bool, dumbterm bool, minimal bool) string {
 	if dumbterm {
@@ -153,187 +219,484 @@ func BufferToDiff(buff bytes.Buffer,
 	return ret
 }
 
-func SemanticChanges(
-	dmp *diffmatchpatch.DiffMatchPatch,
-	diffs []diffmatchpatch.Diff,
-	filename string,
-	headTree []byte,
-	headTreeString string,
-	parseType types.ParseType,
-	dumbterm bool,
-	minimal bool) string {
+// localFiles splits a filename like "A -> B", which in arguably too much
+// cleverness marks comparison of two local files rather than to a git
+// branch/revision
+func localFiles(filename string) (string, string, bool) {
+	fileNames := strings.Split(filename, " -> ")
+	if len(fileNames) != 2 {
+		return "", "", false
+	}
+	return fileNames[0], fileNames[1], true
+}
 
-	var gitDiff []byte
-	var err error
-	var file1, file2 string
-
-	// In arguably too much cleverness, a filename like "A -> B" marks
-	// comparison of two local files rather than to git branch/revision
-	reLocalFiles := regexp.MustCompile(` -> `)
-	if reLocalFiles.MatchString(filename) {
-		fileNames := strings.Split(filename, " -> ")
-		file1 = fileNames[0]
-		file2 = fileNames[1]
+// sourceDiff produces the diff of the source files underlying a comparison.
+// For a revision, the diff is against that revision, as its tree is.  When
+// either side is not plain UTF-8 with LF line endings, the normalized texts
+// are compared instead, as it is those that were parsed.
+func sourceDiff(filename string, options types.Options) []byte {
+	if head, current, err := readSources(filename, options); err == nil {
+		headText, headFormat := Normalize(head)
+		currentText, currentFormat := Normalize(current)
+		if !headFormat.Plain() || !currentFormat.Plain() {
+			return normalizedDiff(filename, headText, currentText)
+		}
+	}
+
+	if file1, file2, local := localFiles(filename); local {
 		// System `diff` exits with non-zero status 1 for diff found
 		cmdDiff := exec.Command("diff", "-u", file1, file2)
 		// Misnomer of `gitDiff`, but we keep it consistent with other uses
-		gitDiff, err = cmdDiff.Output()
+		gitDiff, err := cmdDiff.Output()
 		if err != nil && err.Error() != "exit status 1" {
 			Fail("Could not perform local diff on %s -> %s", file1, file2)
 		}
-	} else {
-		// What git thinks has changed in actual source since last push
-		file1 = filename
-		cmdGitDiff := exec.Command("git", "diff", filename)
-		gitDiff, err = cmdGitDiff.Output()
+		return gitDiff
+	}
+
+	// What git thinks has changed in actual source since the revision
+	revision := strings.TrimSuffix(options.Source, ":")
+	cmdGitDiff := exec.Command("git", "diff", revision, "--", filename)
+	gitDiff, err := cmdGitDiff.Output()
+	if err != nil {
+		Fail("Could not peform git diff against local files")
+	}
+	return gitDiff
+}
+
+// normalizedDiff runs `diff -u` over normalized texts, labelling them as
+// `git diff` would
+func normalizedDiff(filename string, head []byte, current []byte) []byte {
+	label1, label2 := "a/"+filename, "b/"+filename
+	if file1, file2, local := localFiles(filename); local {
+		label1, label2 = file1, file2
+	}
+	var names []string
+	for _, text := range [][]byte{head, current} {
+		tmpfile, err := os.CreateTemp("", "sdt-*")
 		if err != nil {
-			Fail("Could not peform git diff against local files")
-		}
-	}
-
-	// Determine the changes to the respective parse trees
-	patch := dmp.PatchToText(dmp.PatchMake(diffs))
-
-	// Only interested in line offsets of the change in parse tree
-	reFromTo := regexp.MustCompile(`(?m)^[^@].*$[\r\n]*`)
-	ranges := reFromTo.ReplaceAllString(patch, "")
-	rangeLines := strings.Split(ranges, "\n")
-
-	var oldStart uint32
-	var oldCount uint32
-	var newStart uint32
-	var newCount uint32
-	var lineOfInterest uint32
-	var posOfInterest uint32
-	var n int
-
-	offsets := MakeOffsetsFromString(headTreeString)
-	treeLines := bytes.Split(headTree, []byte("\n"))
-
-	// Successive diffs will add or remove characters
-	adjustment := 0
-	diffLines := mapset.NewSet[uint32]()
-	diffPositions := mapset.NewSet[uint32]()
-	// Create set under assumption we'll need to put more in it
-	posNotLine := mapset.NewSet[types.ParseType]()
-	posNotLine.Add(types.JavaScript)
-
-	for i := 0; i < len(rangeLines); i++ {
-		n, _ = fmt.Sscanf(
-			rangeLines[i],
-			"@@ -%d,%d +%d,%d @@",
-			&oldStart, &oldCount, &newStart, &newCount,
-		)
-		if n == 4 {
-			var m int
-
-			tweakedPosition := uint32(int(oldStart) + adjustment)
-			adjustment += int(oldCount) - int(newCount)
-			parseTreeLineNum := LineAtPosition(offsets, tweakedPosition)
-
-			// Try a few lines before and after the line found for underlying
-			// source code position (possible false positives aren't so important)
-			// Parse trees tend to have a lot of lines, so looking at 8 of them
-			// is not all that likely to grab a lot that is not in the same
-			// diff segment.  If it does, the developer can reject the false hit.
-			minLine := Max(parseTreeLineNum-4, 0)
-			maxLine := Min(parseTreeLineNum+4, len(treeLines))
-			switch parseType {
-			case types.Ruby:
-				for j := minLine; j < maxLine; j++ {
-					line := string(treeLines[j])
-					lines := strings.Split(line, "(")
-					if len(lines) > 1 {
-						m, _ = fmt.Sscanf(lines[1], "line: %d", &lineOfInterest)
-						if m == 1 {
-							diffLines.Add(lineOfInterest)
-						}
-					}
-				}
-			case types.Python:
-				for j := minLine; j < maxLine; j++ {
-					line := string(treeLines[j])
-					reLeadingSpace := regexp.MustCompile("^[\n\r\t ]+")
-					line = reLeadingSpace.ReplaceAllString(line, "")
-					m, _ = fmt.Sscanf(line, "lineno=%d", &lineOfInterest)
-					if m == 1 {
-						diffLines.Add(lineOfInterest)
-					}
-					m, _ = fmt.Sscanf(line, "end_lineno=%d", &lineOfInterest)
-					if m == 1 {
-						diffLines.Add(lineOfInterest)
-					}
-				}
-			case types.JavaScript:
-				for j := minLine; j < maxLine; j++ {
-					line := string(treeLines[j])
-					reLeadingSpace := regexp.MustCompile("^[\n\r\t ]+")
-					line = reLeadingSpace.ReplaceAllString(line, "")
-					m, _ = fmt.Sscanf(line, `"start": %d"`, &posOfInterest)
-					if m == 1 {
-						diffPositions.Add(posOfInterest)
-					}
-					m, _ = fmt.Sscanf(line, `"end": %d"`, &posOfInterest)
-					if m == 1 {
-						diffPositions.Add(posOfInterest)
-					}
-				}
-			case types.Go:
-				// For specialized parse tree format created by `gotree`,
-				// the line number is always a prefix to the diff line
-				line := string(treeLines[parseTreeLineNum])
-				if line[0:5] == "SrcLn" {
-					continue
-				}
-				lineNo, err := strconv.Atoi(line[0:5])
-				if err != nil {
-					Fail("Cannot find line number in %s parse tree: `%s`", filename, line)
-				}
-				diffLines.Add(uint32(lineNo))
-			case types.Treesit:
-				// For specialized parse tree format created by `treesit`,
-				// the line number is always a prefix to the diff line
-				line := string(treeLines[parseTreeLineNum])
-				if line[0:5] == "SrcLn" {
-					continue
-				}
-				lineNo, err := strconv.Atoi(line[0:5])
-				if err != nil {
-					Fail("Cannot find line number in %s parse tree: `%s`", filename, line)
-				}
-				diffLines.Add(uint32(lineNo))
+			Fail("Could not create a temporary file for %s", filename)
+		}
+		defer os.Remove(tmpfile.Name()) // clean up
+		tmpfile.Write(text)
+		tmpfile.Close()
+		names = append(names, tmpfile.Name())
+	}
+
+	cmdDiff := exec.Command("diff", "-u",
+		"--label", label1, "--label", label2, names[0], names[1])
+	gitDiff, err := cmdDiff.Output()
+	if err != nil && err.Error() != "exit status 1" {
+		Fail("Could not perform diff of normalized %s", filename)
+	}
+	return gitDiff
+}
+
+// readSources retrieves the content of each side of a comparison as stored,
+// failing if either is absent
+func readSources(filename string, options types.Options) ([]byte, []byte, error) {
+	var head, current []byte
+	var err error
+	if file1, file2, local := localFiles(filename); local {
+		if head, err = os.ReadFile(file1); err != nil {
+			return nil, nil, fmt.Errorf("Unable to read local file %s", file1)
+		}
+		if current, err = os.ReadFile(file2); err != nil {
+			return nil, nil, fmt.Errorf("Unable to read local file %s", file2)
+		}
+		return head, current, nil
+	}
+
+	cmdHead := exec.Command("git", "show", options.Source+filename)
+	if head, err = cmdHead.Output(); err != nil {
+		return nil, nil, fmt.Errorf(
+			"Unable to retrieve file %s from branch/revision %s",
+			filename, options.Source)
+	}
+	if current, err = os.ReadFile(filename); err != nil {
+		return nil, nil, fmt.Errorf("Unable to read local file %s", filename)
+	}
+	return head, current, nil
+}
+
+// sourceTexts retrieves the normalized content of each side of a
+// comparison, against which the offsets in its parse trees are resolved
+func sourceTexts(filename string, options types.Options) ([]byte, []byte) {
+	head, current, err := readSources(filename, options)
+	if err != nil {
+		Fail("%s", err)
+	}
+	head, _ = Normalize(head)
+	current, _ = Normalize(current)
+	return head, current
+}
+
+// FormatChanges describes changes of encoding or line endings between the
+// sides of a comparison, as named in the manner of SemanticChanges().  A
+// file absent from either side has none.
+func FormatChanges(filename string, options types.Options) []string {
+	if filename == "" {
+		filename = options.Source + " -> " + options.Destination
+	}
+	head, current, err := readSources(filename, options)
+	if err != nil {
+		return nil
+	}
+	_, headFormat := Normalize(head)
+	_, currentFormat := Normalize(current)
+	return headFormat.Changes(currentFormat)
+}
+
+// Parsers reporting offsets into the source rather than line numbers, by
+// the name of their command in the configuration
+var offsetCommands = map[types.ParseType]string{
+	types.JavaScript: "javascript",
+}
+
+// Languages by parse type, as they are named in the configuration
+var languages = map[types.ParseType]string{
+	types.Python:     "python",
+	types.Ruby:       "ruby",
+	types.JavaScript: "javascript",
+	types.Go:         "go",
+	types.Treesit:    "treesit",
+}
+
+// SemanticChanges matches the nodes of the two parse trees structurally,
+// and shows those segments of the source diff that touch the lines of any
+// node inserted, deleted, updated, or moved.  The kind of change is judged
+// by whether any of those edits is significant.
+func SemanticChanges(
+	filename string,
+	headTree []byte,
+	currentTree []byte,
+	parseType types.ParseType,
+	options types.Options,
+	config types.Config) (string, types.ChangeKind) {
+
+	gitDiff := sourceDiff(filename, options)
+
+	// A tree is missing when, e.g., a file is absent from the revision
+	if len(bytes.TrimSpace(headTree)) == 0 || len(bytes.TrimSpace(currentTree)) == 0 {
+		if bytes.Equal(headTree, currentTree) {
+			return types.NoSemanticDiff, types.Cosmetic
+		}
+		return changedGitSegments(gitDiff, nil, options), types.Semantic
+	}
+
+	compared := compareTrees(filename, headTree, currentTree, parseType, options, config)
+	edits, language := compared.edits, compared.language
+	// Changes to comments and docstrings may be reported apart from code
+	var docs string
+	if options.Docs == types.DocsSeparate && !options.RulesTest {
+		docs = documentationChanges(gitDiff, edits, language, options)
+	}
+	if !config.OrderMatters(language) {
+		edits = treediff.RelocateDeclarations(edits, config.OrderMatters("decorated"))
+	}
+	var relocations []treediff.Edit
+	change := types.Cosmetic
+	for _, edit := range edits {
+		if edit.Op == treediff.Relocate {
+			relocations = append(relocations, edit)
+		}
+		if significant(edit, options) {
+			change = types.Semantic
+		}
+	}
+
+	if options.RulesTest {
+		return firedRules(gitDiff, compared.srcFired, compared.dstFired, options), change
+	}
+	if len(edits) == 0 && (options.Show != types.ShowAll || options.Symbols) {
+		return joinReports(docs, types.NoSemanticDiff), change
+	}
+
+	if options.Symbols {
+		report := changedSymbols(edits, options)
+		if change == types.Cosmetic {
+			report += "\n" + types.NoSemanticDiff
+		}
+		return report, change
+	}
+
+	changes := indexEdits(edits, config.Weights(language))
+	var report, moved, verdict string
+	if change == types.Semantic || options.Show == types.ShowAll {
+		report = changedGitSegments(gitDiff, changes, options)
+	}
+	// The segments of relocations are shown only with the others
+	if len(relocations) > 0 && options.Show != types.ShowAll {
+		moved = movedDeclarations(relocations, options)
+	}
+	if change == types.Cosmetic {
+		verdict = types.NoSemanticDiff
+	}
+	return joinReports(report, moved, docs, verdict), change
+}
+
+// comparison is the outcome of matching two parse trees, as normalized
+type comparison struct {
+	src      *treediff.Node
+	dst      *treediff.Node
+	edits    []treediff.Edit
+	language string
+	srcFired []treediff.Firing // Where rewrite rules fired in each tree
+	dstFired []treediff.Firing
+}
+
+// compareTrees interprets two parse trees and normalizes them as every
+// comparison does, by literal values, rewrite rules, the order of
+// unordered constructs, and renames, then finds the edits between them
+func compareTrees(
+	filename string,
+	headTree []byte,
+	currentTree []byte,
+	parseType types.ParseType,
+	options types.Options,
+	config types.Config) comparison {
+
+	// Offsets in each tree are resolved against its own revision's text
+	var headPosition, currentPosition treediff.Position
+	if command, found := offsetCommands[parseType]; found {
+		unit := config.Commands[command].Offsets
+		head, current := sourceTexts(filename, options)
+		headPosition = NewPositions(head, unit).LineCol
+		currentPosition = NewPositions(current, unit).LineCol
+	}
+
+	srcTree, err := treediff.Parse(headTree, parseType, headPosition)
+	if err != nil {
+		Fail("Unable to interpret parse tree for %s (%s)", filename, err)
+	}
+	dstTree, err := treediff.Parse(currentTree, parseType, currentPosition)
+	if err != nil {
+		Fail("Unable to interpret parse tree for %s (%s)", filename, err)
+	}
+
+	language := languages[parseType]
+	rules, err := treediff.CompileRules(config.Rules, language)
+	if err != nil {
+		Fail("Unable to use the rewrite rules (%s)", err)
+	}
+	unordered := config.UnorderedIn(language)
+	srcFired := normalizeTree(srcTree, parseType, rules)
+	dstFired := normalizeTree(dstTree, parseType, rules)
+	treediff.RenameIdentifiers(srcTree, options.Renames)
+	if options.Alpha {
+		treediff.CanonicalizeLocals(srcTree, parseType)
+		treediff.CanonicalizeLocals(dstTree, parseType)
+	}
+	// Unordered children are sorted by the names they compare with
+	treediff.SortUnordered(srcTree, unordered)
+	treediff.SortUnordered(dstTree, unordered)
+
+	edits := treediff.DropUnorderedMoves(treediff.Diff(srcTree, dstTree), unordered)
+	if options.Alpha {
+		edits = treediff.ConsistentRenames(edits)
+	}
+	return comparison{
+		src:      srcTree,
+		dst:      dstTree,
+		edits:    edits,
+		language: language,
+		srcFired: srcFired,
+		dstFired: dstFired,
+	}
+}
+
+// normalizeTree puts one tree in the form every comparison uses, its
+// literals by value and rewritten by the rules, giving where the rules
+// fired.  Its unordered constructs are sorted apart, once any renames
+// are applied.
+func normalizeTree(
+	tree *treediff.Node,
+	parseType types.ParseType,
+	rules []treediff.Rule) []treediff.Firing {
+
+	treediff.NormalizeLiterals(tree, parseType)
+	return treediff.ApplyRules(tree, rules)
+}
+
+// ModelTree interprets the parse tree of one file as the tree model, in
+// the form semantic diffs compare before any renames.  The text of the
+// file resolves the offsets of parsers reporting them.
+func ModelTree(
+	raw []byte,
+	text []byte,
+	parseType types.ParseType,
+	config types.Config) (*treediff.Node, error) {
+
+	var position treediff.Position
+	if command, found := offsetCommands[parseType]; found {
+		position = NewPositions(text, config.Commands[command].Offsets).LineCol
+	}
+	tree, err := treediff.Parse(raw, parseType, position)
+	if err != nil {
+		return nil, err
+	}
+	language := languages[parseType]
+	rules, err := treediff.CompileRules(config.Rules, language)
+	if err != nil {
+		return nil, err
+	}
+	normalizeTree(tree, parseType, rules)
+	treediff.SortUnordered(tree, config.UnorderedIn(language))
+	return tree, nil
+}
+
+// joinReports puts the parts of a report one after another, omitting any
+// that are empty
+func joinReports(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// indexEdits finds the edits touching each line.  Lines of the old file
+// come from the source tree, and lines of the new file from the
+// destination, so each side of a hunk is judged alone.
+func indexEdits(edits []treediff.Edit, weights map[string]float64) *lineEdits {
+	changes := &lineEdits{
+		old:     map[int][]treediff.Edit{},
+		new:     map[int][]treediff.Edit{},
+		weights: weights,
+	}
+	for _, edit := range edits {
+		if edit.Src != nil {
+			for _, line := range edit.Src.Lines() {
+				changes.old[line] = append(changes.old[line], edit)
+			}
+		}
+		if edit.Dst != nil {
+			for _, line := range edit.Dst.Lines() {
+				changes.new[line] = append(changes.new[line], edit)
 			}
 		}
 	}
+	return changes
+}
 
-	// Some parse types have byte postions in original file, not lines numbers
-	if posNotLine.Contains(parseType) {
-		data, err := os.ReadFile(file1)
-		if err != nil {
-			Fail("Unable to read local file %s", filename)
+// significant is true of an edit that changes what a program does, as
+// opposed to, e.g., a relocation, or documentation when that is apart
+func significant(edit treediff.Edit, options types.Options) bool {
+	if options.DocsApart() && treediff.Documentation(edit) {
+		return false
+	}
+	return treediff.Semantic(edit)
+}
+
+// Comments, by language, beginning a line or following code and space.  A
+// comment within a string may be mistaken for one, but only on lines no
+// edit of the trees touches.
+var commentMarkers = map[string]*regexp.Regexp{
+	"python":     regexp.MustCompile(`(^|\s)#`),
+	"ruby":       regexp.MustCompile(`(^|\s)#`),
+	"go":         regexp.MustCompile(`(^|\s)(//|/\*)|^\s*\*`),
+	"javascript": regexp.MustCompile(`(^|\s)(//|/\*)|^\s*\*`),
+	"treesit":    regexp.MustCompile(`(^|\s)(#|//|/\*|--|;)|^\s*\*`),
+}
+
+// commentText is the text of the comment on a line, without its spacing,
+// or "" when the line has none
+func commentText(marker *regexp.Regexp, text string) string {
+	loc := marker.FindStringIndex(text)
+	if loc == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(text[loc[1]:]), "")
+}
+
+// changedComments finds the changed lines of a hunk, untouched by any edit
+// of the trees, whose comment differs from that of the line paired with
+// them, or that add or remove a comment whole
+func changedComments(
+	hunk Hunk,
+	marker *regexp.Regexp,
+	changes *lineEdits) map[DiffLine]bool {
+
+	commented := map[DiffLine]bool{}
+	if marker == nil {
+		return commented
+	}
+	lines := hunk.Lines
+	partners := map[int]int{}
+	for removed, added := range pairLines(lines) {
+		partners[removed] = added
+		partners[added] = removed
+	}
+	for i, line := range lines {
+		if line.Op == ' ' || len(changes.touching(line)) > 0 {
+			continue
 		}
-		lineOffsets := MakeOffsetsFromByteArray(data)
-		for pos := range diffPositions.Iterator().C {
-			diffLines.Add(uint32(LineAtPosition(lineOffsets, pos)))
+		comment := commentText(marker, line.Text)
+		if partner, ok := partners[i]; ok {
+			commented[line] = comment != commentText(marker, lines[partner].Text)
+		} else {
+			commented[line] = comment != ""
+		}
+	}
+	return commented
+}
+
+// documentationChanges shows the runs of changed lines in the source diff
+// that change comments or docstrings, found by the edits classified so,
+// and by the comments of lines the trees do not see
+func documentationChanges(
+	gitDiff []byte,
+	edits []treediff.Edit,
+	language string,
+	options types.Options) string {
+
+	var docEdits []treediff.Edit
+	for _, edit := range edits {
+		if treediff.Documentation(edit) {
+			docEdits = append(docEdits, edit)
+		}
+	}
+	docChanges := indexEdits(docEdits, nil)
+	allChanges := indexEdits(edits, nil)
+	marker := commentMarkers[language]
+	var hunks []Hunk
+	for _, hunk := range ParseHunks(gitDiff) {
+		commented := changedComments(hunk, marker, allChanges)
+		documented := func(line DiffLine) bool {
+			return len(docChanges.touching(line)) > 0 || commented[line]
 		}
+		hunks = append(hunks, hunk.Narrow(documented, segmentContext)...)
+	}
+	if len(hunks) == 0 {
+		return ""
 	}
 
-	if len(ranges) > 0 {
-		changedSegments := changedGitSegments(
-			gitDiff, diffLines, dumbterm, minimal)
-		return changedSegments
+	var highlights types.Highlights
+	if options.Dumbterm {
+		highlights = types.PlainASCII
 	} else {
-		return "| No semantic differences detected"
+		highlights = types.Colors
+	}
+	var buff bytes.Buffer
+	buff.WriteString(highlights.Header)
+	buff.WriteString("Documentation changes\n")
+	buff.WriteString(highlights.Clear)
+	for _, hunk := range hunks {
+		writeHunk(&buff, hunk, "", highlights, nil)
 	}
+	return BufferToDiff(buff, true, options.Dumbterm, options.Minimal)
 }
 
-// ColorDiff converts (DiffMatchPatch, []Diff) into colored text report
+// ColorDiff converts (DiffMatchPatch, []Diff) into colored text report,
+// judging any difference between the trees semantic
 func ColorDiff(
 	dmp *diffmatchpatch.DiffMatchPatch,
 	diffs []diffmatchpatch.Diff,
 	parseType types.ParseType,
 	dumbterm bool,
-	minimal bool) string {
+	minimal bool) (string, types.ChangeKind) {
 
 	var highlights types.Highlights
 	if dumbterm {
@@ -396,18 +759,252 @@ func ColorDiff(
 		}
 	}
 	if changed {
-		return BufferToDiff(buff, false, dumbterm, minimal)
+		return BufferToDiff(buff, false, dumbterm, minimal), types.Semantic
+	}
+
+	return types.NoSemanticDiff, types.Cosmetic
+}
+
+// TreeChanges shows the differences between two parse trees, normalized
+// as for semantic diffs, in a view folding the unchanged subtrees and
+// expanding only the paths to changes, options.ContextDepth levels of
+// surrounding structure shown.  Without a tree model of the language, or
+// with a tree missing, the change is Unsupported, and the trees are
+// compared as text.
+func TreeChanges(
+	filename string,
+	headTree []byte,
+	currentTree []byte,
+	parseType types.ParseType,
+	options types.Options,
+	config types.Config) (string, types.ChangeKind) {
+
+	if !treediff.Supported(parseType) ||
+		len(bytes.TrimSpace(headTree)) == 0 || len(bytes.TrimSpace(currentTree)) == 0 {
+		return "", types.Unsupported
+	}
+	compared := compareTrees(filename, headTree, currentTree, parseType, options, config)
+	if len(compared.edits) == 0 {
+		return types.NoSemanticDiff, types.Cosmetic
+	}
+
+	var highlights types.Highlights
+	if options.Dumbterm {
+		highlights = types.PlainASCII
+	} else {
+		highlights = types.Colors
+	}
+	colors := map[byte]string{
+		'+': highlights.Add,
+		'-': highlights.Del,
+		'~': highlights.Info,
+		'>': highlights.Info,
+		'=': highlights.Neutral,
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString(highlights.Header)
+	buff.WriteString("Changes to the parse tree, unchanged subtrees folded\n")
+	buff.WriteString(highlights.Clear)
+	view := treediff.View(compared.src, compared.dst, compared.edits, options.ContextDepth)
+	for _, line := range view {
+		buff.WriteString(colors[line.Op])
+		buff.WriteString(string(line.Op) + " " + line.Text)
+		if colors[line.Op] != "" {
+			buff.WriteString(highlights.Clear)
+		}
+		buff.WriteString("\n")
+	}
+	return BufferToDiff(buff, true, options.Dumbterm, options.Minimal), types.Semantic
+}
+
+// movedDeclarations lists the declarations which were relocated
+func movedDeclarations(relocations []treediff.Edit, options types.Options) string {
+	var highlights types.Highlights
+	if options.Dumbterm {
+		highlights = types.PlainASCII
+	} else {
+		highlights = types.Colors
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString(highlights.Header)
+	buff.WriteString("Declarations moved, which is not a semantic change\n")
+	buff.WriteString(highlights.Clear)
+	for _, symbol := range treediff.Symbols(relocations) {
+		buff.WriteString(symbol + "\n")
+	}
+	return BufferToDiff(buff, true, options.Dumbterm, false)
+}
+
+// firedRules lists the rewrite rules that fired on the changed lines of
+// each hunk of the source diff, on the old side or the new, and counts
+// those that fired elsewhere
+func firedRules(
+	gitDiff []byte,
+	srcFired []treediff.Firing,
+	dstFired []treediff.Firing,
+	options types.Options) string {
+
+	if len(srcFired) == 0 && len(dstFired) == 0 {
+		return "| No rewrite rules fired"
+	}
+	var highlights types.Highlights
+	if options.Dumbterm {
+		highlights = types.PlainASCII
+	} else {
+		highlights = types.Colors
+	}
+
+	var buff bytes.Buffer
+	buff.WriteString(highlights.Header)
+	buff.WriteString("Rewrite rules fired within changed segments\n")
+	buff.WriteString(highlights.Clear)
+	reported := map[*treediff.Firing]bool{}
+	within := func(fired *treediff.Firing, line int) bool {
+		return line >= fired.Span.StartLine && line <= fired.Span.EndLine
+	}
+	sides := []struct {
+		name  string
+		fired []treediff.Firing
+		op    byte
+	}{{"old", srcFired, '-'}, {"new", dstFired, '+'}}
+	for _, hunk := range ParseHunks(gitDiff) {
+		var lines []string
+		for _, side := range sides {
+			for i := range side.fired {
+				fired := &side.fired[i]
+				for _, line := range hunk.Lines {
+					number := line.Old
+					if side.op == '+' {
+						number = line.New
+					}
+					if line.Op == side.op && within(fired, number) {
+						reported[fired] = true
+						lines = append(lines, fmt.Sprintf("   %s: %s line %d",
+							fired.Rule, side.name, fired.Span.StartLine))
+						break
+					}
+				}
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		buff.WriteString(highlights.Info + hunk.Header() + highlights.Clear + "\n")
+		for _, line := range lines {
+			buff.WriteString(line + "\n")
+		}
+	}
+	elsewhere := map[string]int{}
+	var names []string
+	for _, side := range sides {
+		for i := range side.fired {
+			if fired := &side.fired[i]; !reported[fired] {
+				if elsewhere[fired.Rule] == 0 {
+					names = append(names, fired.Rule)
+				}
+				elsewhere[fired.Rule]++
+			}
+		}
+	}
+	for _, name := range names {
+		fmt.Fprintf(&buff, "%s also fired on unchanged lines (%d)\n", name, elsewhere[name])
+	}
+	return BufferToDiff(buff, true, options.Dumbterm, false)
+}
+
+// changedSymbols lists the declarations the edits fall within, and how
+// each changed
+func changedSymbols(edits []treediff.Edit, options types.Options) string {
+	var highlights types.Highlights
+	if options.Dumbterm {
+		highlights = types.PlainASCII
+	} else {
+		highlights = types.Colors
 	}
 
-	return "| No semantic differences detected"
+	var buff bytes.Buffer
+	buff.WriteString(highlights.Header)
+	buff.WriteString("Declarations with likely semantic changes\n")
+	buff.WriteString(highlights.Clear)
+	for _, symbol := range treediff.Symbols(edits) {
+		buff.WriteString(symbol + "\n")
+	}
+	// Every line is a change, so none is dropped as in a minimal diff
+	return BufferToDiff(buff, true, options.Dumbterm, false)
+}
+
+// Unchanged lines shown around each run of changes in a narrowed segment
+const segmentContext = 1
+
+// lineEdits indexes the edits between two trees by the lines of the old
+// and of the new file that they touch
+type lineEdits struct {
+	old     map[int][]treediff.Edit
+	new     map[int][]treediff.Edit
+	weights map[string]float64 // Of the kinds of risk in the language
 }
 
+// touching lists the edits touching a line of a diff.  A removed line is
+// looked up among the old lines, and an added line among the new lines.
+func (changes *lineEdits) touching(line DiffLine) []treediff.Edit {
+	switch line.Op {
+	case '-':
+		return changes.old[line.Old]
+	case '+':
+		return changes.new[line.New]
+	}
+	return nil
+}
+
+// Prefixes of lines that are likely comments, across languages
+var reCommentLine = regexp.MustCompile(`^\s*(#|//|/\*|\*|--|;|%|$)`)
+
+// segment is a narrowed hunk of the source diff, judged by the edits
+// touching its lines
+type segment struct {
+	Hunk
+	category treediff.Category
+	risk     float64
+}
+
+// judgeSegment classifies the change in a segment and scores its risk from
+// the edits touching its lines.  A segment touched by none changed nothing
+// the parser sees, so is either comments or layout, and carries no risk.
+func judgeSegment(hunk Hunk, changes *lineEdits) segment {
+	var edits []treediff.Edit
+	comments := true
+	for _, line := range hunk.Lines {
+		edits = append(edits, changes.touching(line)...)
+		if line.Op != ' ' && !reCommentLine.MatchString(line.Text) {
+			comments = false
+		}
+	}
+	judged := segment{Hunk: hunk, category: treediff.Layout}
+	if len(edits) > 0 {
+		judged.category = treediff.ClassifyAll(edits)
+		judged.risk = treediff.Risk(edits, changes.weights)
+	} else if comments {
+		judged.category = treediff.Comment
+	}
+	return judged
+}
+
+// changedGitSegments shows those runs of changed lines in the source diff
+// that are touched by some edit, as hunks narrowed to just those runs and
+// labelled by the nature of the change and its risk.  With options.Show of
+// "all", every run is shown, including those the parser did not see, and
+// with options.Sort of "risk", the riskiest runs come first.  Without
+// changes, the analysis was not possible, and whole hunks are shown
+// unlabelled in order.
 func changedGitSegments(
 	gitDiff []byte,
-	diffLines mapset.Set[uint32],
-	dumbterm bool,
-	minimal bool) string {
+	changes *lineEdits,
+	options types.Options) string {
 
+	dumbterm, minimal := options.Dumbterm, options.Minimal
+	showAll := options.Show == types.ShowAll
 	var highlights types.Highlights
 	if dumbterm {
 		highlights = types.PlainASCII
@@ -416,60 +1013,136 @@ func changedGitSegments(
 	}
 
 	var buff bytes.Buffer
-	lines := bytes.Split(gitDiff, []byte("\n"))
-	showSegment := false
-	var oldStart uint32
-	var oldCount uint32
-	var newStart uint32
-	var newCount uint32
-
 	buff.WriteString(highlights.Header)
-	buff.WriteString("Segments with likely semantic changes\n")
-
-	for _, line := range lines {
-		n, _ := fmt.Sscanf(
-			string(line),
-			"@@ -%d,%d +%d,%d @@",
-			&oldStart, &oldCount, &newStart, &newCount,
-		)
-
-		if n == 4 {
-			minLine := Min(oldStart, newStart)
-			maxLine := Max(oldStart+oldCount, newStart+newCount)
-			showSegment = false
-			for i := minLine; i <= maxLine; i++ {
-				if diffLines.Contains(i) {
-					showSegment = true
-					break
-				}
+	if showAll && changes != nil {
+		buff.WriteString("Segments by kind of change\n")
+	} else {
+		buff.WriteString("Segments with likely semantic changes\n")
+	}
+
+	// Relocated declarations and respelled names alone are not semantic
+	interesting := func(line DiffLine) bool {
+		for _, edit := range changes.touching(line) {
+			if significant(edit, options) {
+				return true
+			}
+		}
+		return showAll
+	}
+	var segments []segment
+	apart := 0
+	for _, hunk := range ParseHunks(gitDiff) {
+		if changes == nil {
+			segments = append(segments, segment{Hunk: hunk})
+			continue
+		}
+		for _, narrowed := range hunk.Narrow(interesting, segmentContext) {
+			judged := judgeSegment(narrowed, changes)
+			// Documentation shown apart, or hidden, is not shown here
+			if options.DocsApart() &&
+				(judged.category == treediff.Comment || judged.category == treediff.Docstring) {
+				apart++
+				continue
 			}
+			segments = append(segments, judged)
 		}
+	}
+	if len(segments) == 0 && apart > 0 {
+		return ""
+	}
+	if options.Sort == types.SortRisk && changes != nil {
+		sort.SliceStable(segments, func(i, j int) bool {
+			return segments[i].risk > segments[j].risk
+		})
+	}
+
+	for _, segment := range segments {
+		label := ""
+		if changes != nil {
+			label = fmt.Sprintf(" [%s, risk %g]", segment.category, segment.risk)
+		}
+		var words map[int]string
+		if changes != nil && (options.WordDiff || !dumbterm) {
+			words = changedWords(segment.Hunk, changes, options, highlights)
+		}
+		writeHunk(&buff, segment.Hunk, label, highlights, words)
+		if options.Explain && changes != nil {
+			writeExplanations(&buff, segment.Hunk, changes, options, highlights)
+		}
+	}
+	return BufferToDiff(buff, true, dumbterm, minimal)
+}
+
+// writeExplanations follows a hunk with the subtrees of the normalized
+// trees that differ on its lines, each pair once.  Edits that are not
+// significant are explained only where every segment is shown.
+func writeExplanations(
+	buff *bytes.Buffer,
+	hunk Hunk,
+	changes *lineEdits,
+	options types.Options,
+	highlights types.Highlights) {
 
-		if showSegment {
-			prefix := byte(' ')
-			if len(line) > 0 {
-				prefix = line[0]
+	seen := map[string]bool{}
+	for _, line := range hunk.Lines {
+		for _, edit := range changes.touching(line) {
+			if !significant(edit, options) && options.Show != types.ShowAll {
+				continue
 			}
-			switch prefix {
-			case byte('@'):
-				buff.WriteString(highlights.Info)
-				buff.Write(line)
-				buff.WriteString(highlights.Clear)
-			case byte('+'):
-				buff.WriteString(highlights.Add)
-				buff.Write(line)
-				buff.WriteString(highlights.Clear)
-			case byte('-'):
-				buff.WriteString(highlights.Del)
-				buff.Write(line)
-				buff.WriteString(highlights.Clear)
-			default:
-				buff.Write(line)
+			explanation := treediff.Explain(edit)
+			if seen[explanation] {
+				continue
 			}
+			seen[explanation] = true
+			buff.WriteString(highlights.Neutral)
+			buff.WriteString("  tree: " + explanation)
+			buff.WriteString(highlights.Clear)
 			buff.WriteString("\n")
 		}
 	}
-	return BufferToDiff(buff, true, dumbterm, minimal)
+}
+
+// writeHunk renders a hunk, its header followed by any label.  Lines given
+// among the words, by their index, are written as given there.
+func writeHunk(
+	buff *bytes.Buffer,
+	hunk Hunk,
+	label string,
+	highlights types.Highlights,
+	words map[int]string) {
+
+	buff.WriteString(highlights.Info)
+	buff.WriteString(hunk.Header() + label)
+	buff.WriteString(highlights.Clear)
+	buff.WriteString("\n")
+	for i, line := range hunk.Lines {
+		text, found := words[i]
+		if !found {
+			text = line.Text
+		}
+		switch line.Op {
+		case '+':
+			buff.WriteString(highlights.Add)
+			buff.WriteString("+" + text)
+			buff.WriteString(highlights.Clear)
+		case '-':
+			buff.WriteString(highlights.Del)
+			buff.WriteString("-" + text)
+			buff.WriteString(highlights.Clear)
+		default:
+			buff.WriteString(" " + line.Text)
+		}
+		buff.WriteString("\n")
+	}
+}
+
+// treeCommand prepares to run a parser or canonicalizer.  SDT_SPANS asks
+// the helper tools `gotree` and `treesit` to report the columns of nodes,
+// and not only their lines; other tools ignore it.
+func treeCommand(cmd string, args ...string) *exec.Cmd {
+	command := exec.Command(cmd, args...)
+	command.Env = append(os.Environ(), "SDT_SPANS=1")
+	return command
 }
 
 func LocalFileTrees(
@@ -484,7 +1157,13 @@ func LocalFileTrees(
 	var err error
 	filename := options.Source + " -> " + options.Destination
 
-	cmdHeadTree := exec.Command(cmd, append(switches, options.Source)...)
+	// Parsers are given normalized text, whatever the encoding on disk
+	source, cleanSource := normalizedFile(options.Source)
+	defer cleanSource()
+	destination, cleanDestination := normalizedFile(options.Destination)
+	defer cleanDestination()
+
+	cmdHeadTree := treeCommand(cmd, append(switches, source)...)
 	headTree, err = cmdHeadTree.Output()
 	if err != nil {
 		if langName == "Tree-Sitter" {
@@ -499,7 +1178,7 @@ func LocalFileTrees(
 		}
 	}
 
-	cmdCurrentTree := exec.Command(cmd, append(switches, options.Destination)...)
+	cmdCurrentTree := treeCommand(cmd, append(switches, destination)...)
 	currentTree, err = cmdCurrentTree.Output()
 	if err != nil {
 		if langName == "Tree-Sitter" {
@@ -516,6 +1195,17 @@ func LocalFileTrees(
 	return filename, headTree, currentTree
 }
 
+// FileTree runs the parser or canonicalizer for a single file.  Unlike
+// LocalFileTrees() and RevisionToCurrentTree() a failure is returned to the
+// caller, since walking history will often meet files that do not parse.
+func FileTree(cmd string, switches []string, filename string) ([]byte, error) {
+	normalized, cleanup := normalizedFile(filename)
+	defer cleanup()
+	args := append(append([]string{}, switches...), normalized)
+	cmdTree := treeCommand(cmd, args...)
+	return cmdTree.Output()
+}
+
 func RevisionToCurrentTree(
 	filename string,
 	cmd string,
@@ -530,7 +1220,9 @@ func RevisionToCurrentTree(
 	var err error
 
 	// Get the AST for the current version of the file
-	cmdCurrentTree := exec.Command(cmd, append(switches, filename)...)
+	current, cleanup := normalizedFile(filename)
+	defer cleanup()
+	cmdCurrentTree := treeCommand(cmd, append(switches, current)...)
 	currentTree, err = cmdCurrentTree.Output()
 	if err != nil {
 		if langName == "Tree-Sitter" {
@@ -558,11 +1250,12 @@ func RevisionToCurrentTree(
 	if err != nil {
 		Fail("Could not create a temporary %s file", langName)
 	}
+	head, _ = Normalize(head)
 	tmpfile.Write(head)
 	defer os.Remove(tmpfile.Name()) // clean up
 
 	// Get the AST for the HEAD version of the file
-	cmdHeadTree := exec.Command(cmd, append(switches, tmpfile.Name())...)
+	cmdHeadTree := treeCommand(cmd, append(switches, tmpfile.Name())...)
 	headTree, err = cmdHeadTree.Output()
 	if err != nil {
 		if langName == "Tree-Sitter" {
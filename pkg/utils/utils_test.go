@@ -4,6 +4,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/sergi/go-diff/diffmatchpatch"
+
 	"github.com/atlantistechnology/sdt/pkg/utils"
 )
 
@@ -85,3 +87,34 @@ func TestLineAtPosition(t *testing.T) {
 		}
 	}
 }
+
+func TestDiffLines(t *testing.T) {
+	before := "alpha\nbeta\ngamma\n"
+	after := "alpha\ngamma\ndelta\n"
+	diffs := utils.DiffLines(before, after)
+	var removed, added, kept string
+	for _, diff := range diffs {
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			removed += diff.Text
+		case diffmatchpatch.DiffInsert:
+			added += diff.Text
+		case diffmatchpatch.DiffEqual:
+			kept += diff.Text
+		}
+	}
+	if removed != "beta\n" || added != "delta\n" || kept != "alpha\ngamma\n" {
+		t.Fatalf(`DiffLines() wrong: removed %q, added %q, kept %q`,
+			removed, added, kept)
+	}
+}
+
+func TestIndentedSubtree(t *testing.T) {
+	lines := []string{"Module(", "   body=[", "      FunctionDef(",
+		"         name='f',", "         body=[])],", "   type_ignores=[])"}
+	want := []string{"FunctionDef(", "   name='f',", "   body=[])],"}
+	subtree := utils.IndentedSubtree(lines, 2, " ")
+	if !reflect.DeepEqual(subtree, want) {
+		t.Fatalf(`IndentedSubtree() produced %v rather than %v`, subtree, want)
+	}
+}
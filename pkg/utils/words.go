@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/atlantistechnology/sdt/pkg/treediff"
+	"github.com/atlantistechnology/sdt/pkg/types"
+)
+
+// Changes to one token of a changed line, as judged against the edits
+// touching the line
+const (
+	sameToken     = iota
+	cosmeticToken // Differs from the other side, but within no significant edit
+	semanticToken // Differs, within the span of a significant edit
+)
+
+// Lines longer than this, in tokens, are not compared token by token
+const maxLineTokens = 500
+
+// token is a word, number, run of space, operator, or other single
+// character of a line, at a byte column
+type token struct {
+	text   string
+	start  int
+	change int
+}
+
+var reToken = regexp.MustCompile(`\w+|\s+|[-+*/%=<>!&|^~?:]+|.`)
+
+func tokenize(text string) []token {
+	var tokens []token
+	for _, loc := range reToken.FindAllStringIndex(text, -1) {
+		tokens = append(tokens, token{text: text[loc[0]:loc[1]], start: loc[0]})
+	}
+	return tokens
+}
+
+// markChanged marks the tokens of two versions of a line that are outside
+// their longest common subsequence
+func markChanged(old []token, new []token) {
+	// lengths[i][j] is the length of the LCS of old[i:] and new[j:]
+	lengths := make([][]int, len(old)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i].text == new[j].text {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = Max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(old) && j < len(new) {
+		switch {
+		case old[i].text == new[j].text:
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			old[i].change = cosmeticToken
+			i++
+		default:
+			new[j].change = cosmeticToken
+			j++
+		}
+	}
+	for ; i < len(old); i++ {
+		old[i].change = cosmeticToken
+	}
+	for ; j < len(new); j++ {
+		new[j].change = cosmeticToken
+	}
+}
+
+// covers is true where the columns of a line fall within a span.  A span
+// lacking columns covers its lines whole.
+func covers(span treediff.Span, line int, start int, end int) bool {
+	if span.StartLine == 0 || line < span.StartLine || line > span.EndLine {
+		return false
+	}
+	from, to := 0, math.MaxInt
+	if line == span.StartLine {
+		from = span.StartCol
+	}
+	if line == span.EndLine && span.EndCol > from {
+		to = span.EndCol
+	}
+	return start < to && end > from
+}
+
+// judgeTokens finds which changed tokens of a line lie within the nodes of
+// significant edits on its side of the diff
+func judgeTokens(tokens []token, line DiffLine, changes *lineEdits, options types.Options) {
+	number := line.New
+	if line.Op == '-' {
+		number = line.Old
+	}
+	for _, edit := range changes.touching(line) {
+		node := edit.Dst
+		if line.Op == '-' {
+			node = edit.Src
+		}
+		if node == nil || !significant(edit, options) {
+			continue
+		}
+		for i := range tokens {
+			tok := &tokens[i]
+			if tok.change == cosmeticToken && strings.TrimSpace(tok.text) != "" &&
+				covers(node.Span, number, tok.start, tok.start+len(tok.text)) {
+				tok.change = semanticToken
+			}
+		}
+	}
+}
+
+// changedWords renders the paired removed and added lines of a hunk with
+// their changed tokens emphasized where the change is semantic and dimmed
+// where it is cosmetic.
+// With options.WordDiff, semantic changes are instead marked as [-old-]
+// and {+new+} in the text.  The rendered lines are keyed by their index in
+// the hunk; lines added or removed whole are left as they are.
+func changedWords(
+	hunk Hunk,
+	changes *lineEdits,
+	options types.Options,
+	highlights types.Highlights) map[int]string {
+
+	decorated := map[int]string{}
+	lines := hunk.Lines
+	for removed, added := range pairLines(lines) {
+		oldLine, newLine := lines[removed], lines[added]
+		old, new := tokenize(oldLine.Text), tokenize(newLine.Text)
+		if len(old) > maxLineTokens || len(new) > maxLineTokens {
+			continue
+		}
+		markChanged(old, new)
+		judgeTokens(old, oldLine, changes, options)
+		judgeTokens(new, newLine, changes, options)
+		decorated[removed] = decorate(old, '-', options.WordDiff, highlights)
+		decorated[added] = decorate(new, '+', options.WordDiff, highlights)
+	}
+	return decorated
+}
+
+// pairLines pairs the removed and added lines of each run of changes, in
+// order, giving the index of the added line paired with each removed one
+func pairLines(lines []DiffLine) map[int]int {
+	pairs := map[int]int{}
+	for i := 0; i < len(lines); {
+		if lines[i].Op != '-' {
+			i++
+			continue
+		}
+		removed := i
+		for i < len(lines) && lines[i].Op == '-' {
+			i++
+		}
+		added := i
+		for i < len(lines) && lines[i].Op == '+' {
+			i++
+		}
+		for k := 0; removed+k < added && added+k < i; k++ {
+			pairs[removed+k] = added + k
+		}
+	}
+	return pairs
+}
+
+// decorate writes the tokens of a line, setting apart each run of changed
+// tokens of one kind, with any space between them, and restoring the color
+// of the line after it
+func decorate(tokens []token, op byte, markers bool, highlights types.Highlights) string {
+	color, open, close := highlights.Add, "{+", "+}"
+	if op == '-' {
+		color, open, close = highlights.Del, "[-", "-]"
+	}
+	var text strings.Builder
+	for i := 0; i < len(tokens); {
+		change, end := tokens[i].change, i+1
+		if strings.TrimSpace(tokens[i].text) == "" {
+			change = sameToken
+		}
+		for k := end; change != sameToken && k < len(tokens); k++ {
+			if tokens[k].change == change {
+				end = k + 1
+			} else if strings.TrimSpace(tokens[k].text) != "" {
+				break
+			}
+		}
+		var run strings.Builder
+		for _, tok := range tokens[i:end] {
+			run.WriteString(tok.text)
+		}
+		switch {
+		case change == semanticToken && markers:
+			text.WriteString(open + run.String() + close)
+		case change == semanticToken && highlights.Emphasis != "":
+			text.WriteString(highlights.Emphasis + run.String() + highlights.Clear + color)
+		case change == cosmeticToken && highlights.Dim != "":
+			text.WriteString(highlights.Dim + run.String() + highlights.Clear + color)
+		default:
+			text.WriteString(run.String())
+		}
+		i = end
+	}
+	return text.String()
+}